@@ -0,0 +1,275 @@
+package main
+
+import "os"
+import "fmt"
+import "log"
+import "flag"
+import "math"
+import "math/rand"
+import "sort"
+import "time"
+import "context"
+import "strings"
+import "encoding/csv"
+
+import "./gen"
+import "./kbdlayout"
+import "./kbdscoring"
+
+// kbdgen bench -configs <optimizers or option files> -runs <n>
+// kbdgen bench -throughput -scoring-func <scoring funcs>
+//
+// Runs each optimizer configuration a number of times with different
+// seeds on the same budget, and compares the best scores they reach.
+// The runs have one worker, so that a run with -max-evaluations repeats
+// exactly with its seed, unless -workers asks for more.
+// With -throughput measures how fast the scoring funcs score layouts.
+func benchCommand(args []string) {
+	flags := flag.NewFlagSet("bench", flag.ExitOnError)
+	var scoringFuncParam = flags.String("scoring-func", "bigram", "which function to use")
+	var configsParam = flags.String("configs", "genetic,tabu", "comma separated configurations to compare, optimizer names or JSON option files")
+	var runsParam = flags.Int("runs", 10, "number of runs of each configuration")
+	var seedParam = flags.Int64("seed", 1, "seed of the first run, the runs of each configuration get the same seeds")
+	var maxEvaluationsParam = flags.Uint64("max-evaluations", 0, "layouts to score on each run over all workers, 0 for no limit")
+	var maxTimeParam = flags.Duration("max-time", 0, "length of each run, 0 for no limit")
+	var workersParam = flags.Int("workers", 1, "number of workers of each run, more than 1 makes the runs differ on the same seed")
+	var csvParam = flags.String("csv", "", "file to write the best score over time of each run to")
+	var throughputParam = flags.Bool("throughput", false, "measure the layouts scored per second by the comma separated scoring funcs for max-time each (default 2s) instead")
+	common := addCommonFlags(flags)
+	flags.Parse(args)
+	common.apply()
+
+	if *throughputParam {
+		if *maxTimeParam == 0 {
+			*maxTimeParam = 2 * time.Second
+		}
+		for _, name := range strings.Split(*scoringFuncParam, ",") {
+			sf := lookupScoringFunc(strings.TrimSpace(name))
+			sf.Init(defaultMapping)
+			layouts, elapsed := benchThroughput(sf, *maxTimeParam)
+			fmt.Printf("%-12s %12.0f layouts/s %10.1f ns/layout\n", name,
+				float64(layouts)/elapsed.Seconds(), float64(elapsed.Nanoseconds())/float64(layouts))
+		}
+		return
+	}
+
+	if *runsParam < 1 {
+		log.Fatal("bench needs at least one run, use -runs")
+	}
+	if *maxEvaluationsParam == 0 && *maxTimeParam == 0 {
+		log.Fatal("bench needs a budget for the runs, use -max-evaluations or -max-time")
+	}
+
+	var configs []benchConfig
+	for _, name := range strings.Split(*configsParam, ",") {
+		config, err := loadBenchConfig(strings.TrimSpace(name))
+		if err != nil {
+			log.Fatal(err)
+		}
+		// the workers of one run exchange migrants in whatever order
+		// they happen to run, only a single worker repeats its run
+		config.opts.Workers = *workersParam
+		if config.opts.Workers == 1 {
+			config.opts.Topology = "none"
+		}
+		if err := config.opts.Validate(); err != nil {
+			log.Fatalf("%s: %v", config.name, err)
+		}
+		configs = append(configs, config)
+	}
+
+	sf := lookupScoringFunc(*scoringFuncParam)
+	sf.Init(defaultMapping)
+
+	var out *csv.Writer
+	if *csvParam != "" {
+		file, err := os.Create(*csvParam)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer file.Close()
+		out = csv.NewWriter(file)
+		defer out.Flush()
+		out.Write([]string{"config", "run", "seed", "evaluations", "seconds", "score"})
+	}
+
+	budget := benchBudget{maxEvaluations: *maxEvaluationsParam, maxTime: *maxTimeParam}
+	for i := range configs {
+		config := &configs[i]
+		for run := 0; run < *runsParam; run++ {
+			config.opts.Seed = *seedParam + int64(run)
+			curve, err := benchRun(sf, &config.opts, budget)
+			if err != nil {
+				log.Fatalf("%s: %v", config.name, err)
+			}
+			if len(curve) == 0 {
+				log.Fatalf("%s: the budget ended before the first generation", config.name)
+			}
+			last := curve[len(curve)-1]
+			config.scores = append(config.scores, last.score)
+			fmt.Printf("%-20s run %3d seed %6d: %16.12f after %d evaluations in %s\n", config.name, run+1, config.opts.Seed,
+				last.score, last.evaluations, last.elapsed.Round(time.Millisecond))
+
+			if out != nil {
+				for _, point := range curve {
+					out.Write([]string{config.name, fmt.Sprint(run + 1), fmt.Sprint(config.opts.Seed), fmt.Sprint(point.evaluations),
+						fmt.Sprintf("%.3f", point.elapsed.Seconds()), fmt.Sprintf("%.12f", point.score)})
+				}
+				if err := out.Error(); err != nil {
+					log.Fatal(err)
+				}
+			}
+		}
+	}
+
+	fmt.Printf("\n%-20s %5s %16s %16s %16s %16s %16s\n", "config", "runs", "mean", "95% ci", "median", "best", "worst")
+	for _, config := range configs {
+		s := summarize(config.scores)
+		fmt.Printf("%-20s %5d %16.12f %16.12f %16.12f %16.12f %16.12f\n",
+			config.name, len(config.scores), s.mean, s.ci95, s.median, s.best, s.worst)
+	}
+}
+
+// Options of the generator compared under a name
+type benchConfig struct {
+	name   string
+	opts   gen.Options
+	scores []float64 // normalized best score of each run
+}
+
+// Makes a configuration of the name of an optimizer, with the default
+// options, or of a JSON file of options
+func loadBenchConfig(name string) (benchConfig, error) {
+	config := benchConfig{name: name, opts: gen.DefaultOptions()}
+	if _, err := gen.LookupOptimizer(name); err == nil {
+		config.opts.Optimizer = name
+		return config, nil
+	}
+	if _, err := os.Stat(name); err != nil {
+		return config, fmt.Errorf("configuration '%s' is neither a file nor one of the optimizers %v", name, gen.OptimizerNames())
+	}
+	return config, config.opts.Load(name)
+}
+
+// When each run stops, whichever limit comes first
+type benchBudget struct {
+	maxEvaluations uint64
+	maxTime        time.Duration
+}
+
+// Best score so far at a point of a run
+type benchPoint struct {
+	evaluations uint64
+	elapsed     time.Duration
+	score       float64 // normalized
+}
+
+// Runs the generator with the options until the budget is used, returning
+// the best score each time it improved, ending with the best of the run
+func benchRun(sf kbdscoring.ScoringFunction, opts *gen.Options, budget benchBudget) ([]benchPoint, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if budget.maxTime > 0 {
+		ctx, cancel = context.WithTimeout(ctx, budget.maxTime)
+		defer cancel()
+	}
+
+	started := time.Now()
+	var curve []benchPoint
+	// the counts of the workers are cumulative, the total is their sum
+	evaluations := make([]uint64, opts.Workers)
+	var total uint64
+	_, err := gen.Run(ctx, sf, opts, func(next *gen.LayoutEntry, generation uint64, improved bool) bool {
+		total += next.Evaluations - evaluations[next.Worker]
+		evaluations[next.Worker] = next.Evaluations
+		if improved {
+			curve = append(curve, benchPoint{total, time.Since(started), sf.NormalizeScore(next.Score)})
+		}
+		return budget.maxEvaluations > 0 && total >= budget.maxEvaluations
+	})
+	if err != nil && err != context.DeadlineExceeded {
+		return nil, err
+	}
+
+	if len(curve) > 0 {
+		// the end of the budget as the last point of the curve
+		last := curve[len(curve)-1]
+		curve = append(curve, benchPoint{total, time.Since(started), last.score})
+	}
+	return curve, nil
+}
+
+// Scores random layouts for about the given time, returning the number
+// of layouts scored and the time it actually took
+func benchThroughput(sf kbdscoring.ScoringFunction, duration time.Duration) (uint64, time.Duration) {
+	// the same layouts over and over, so making them isn't measured
+	rng := rand.New(rand.NewSource(1))
+	layouts := make([]kbdlayout.KeyboardLayout, 1024)
+	for i := range layouts {
+		for pos, charId := range rng.Perm(30) {
+			layouts[i][pos] = uint8(charId)
+		}
+	}
+
+	var scored uint64
+	var sum uint64 // used, so the scoring can't be optimized away
+	started := time.Now()
+	for time.Since(started) < duration {
+		for i := range layouts {
+			sum += sf.CalculateScore(&layouts[i])
+		}
+		scored += uint64(len(layouts))
+	}
+	elapsed := time.Since(started)
+	if sum == 0 {
+		log.Printf("every layout scored 0")
+	}
+	return scored, elapsed
+}
+
+type summary struct {
+	mean, ci95          float64 // ci95 is the half width of the interval of the mean
+	median, best, worst float64
+}
+
+func summarize(scores []float64) summary {
+	sorted := append([]float64(nil), scores...)
+	sort.Float64s(sorted)
+	n := len(sorted)
+
+	s := summary{worst: sorted[0], best: sorted[n-1]}
+	for _, score := range sorted {
+		s.mean += score
+	}
+	s.mean /= float64(n)
+	if n%2 == 1 {
+		s.median = sorted[n/2]
+	} else {
+		s.median = (sorted[n/2-1] + sorted[n/2]) / 2
+	}
+
+	if n > 1 {
+		var squares float64
+		for _, score := range sorted {
+			squares += (score - s.mean) * (score - s.mean)
+		}
+		stddev := math.Sqrt(squares / float64(n-1))
+		s.ci95 = studentT95(n-1) * stddev / math.Sqrt(float64(n))
+	}
+	return s
+}
+
+// two-sided 95% critical values of Student's t distribution by degrees of freedom
+var studentT95Table = []float64{
+	12.706, 4.303, 3.182, 2.776, 2.571, 2.447, 2.365, 2.306, 2.262, 2.228,
+	2.201, 2.179, 2.160, 2.145, 2.131, 2.120, 2.110, 2.101, 2.093, 2.086,
+	2.080, 2.074, 2.069, 2.064, 2.060, 2.056, 2.052, 2.048, 2.045, 2.042,
+}
+
+func studentT95(degrees int) float64 {
+	if degrees <= len(studentT95Table) {
+		return studentT95Table[degrees-1]
+	}
+	// close enough to the normal distribution
+	return 1.960
+}
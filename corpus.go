@@ -0,0 +1,133 @@
+package main
+
+import "io"
+import "os"
+import "fmt"
+import "log"
+import "flag"
+import "strings"
+import "io/ioutil"
+import "path/filepath"
+
+import "./corpus"
+import "./kbdlayout"
+
+// kbdgen corpus [flags] dir-or-file...
+//
+// Counts the monograms and bigrams of source code, for generating
+// layouts for programming, or of .txt files for a language preset
+func corpusCommand(args []string) {
+	flags := flag.NewFlagSet("corpus", flag.ExitOnError)
+	var monogramsParam = flags.String("monograms", "monograms.txt", "file to write the monogram counts to")
+	var bigramsParam = flags.String("bigrams", "bigrams.txt", "file to write the bigram counts to")
+	var languagesParam = flags.String("languages", "", "comma separated languages to count, all if empty: "+strings.Join(corpus.LanguageNames(), ", "))
+	var stripCommentsParam = flags.Bool("strip-comments", false, "do not count comments")
+	var stripStringsParam = flags.Bool("strip-strings", false, "do not count string literals")
+	var splitIdentifiersParam = flags.Bool("split-identifiers", false, "count camelCase and snake_case identifiers as separate words")
+	var identifierWeightParam = flags.Uint64("identifier-weight", 1, "multiplier for the characters of identifiers")
+	var localeParam = flags.String("locale", "", "language code for lowercasing, e.g. tr to lowercase I to dotless ı, the default rules if empty")
+	var forceParam = flags.Bool("force", false, "overwrite the monogram and bigram files if they exist")
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		log.Fatal("give the directories or files to count")
+	}
+
+	languages := map[*corpus.Language]bool{}
+	if *languagesParam != "" {
+		for _, name := range strings.Split(*languagesParam, ",") {
+			language, ok := corpus.Languages[strings.TrimSpace(name)]
+			if !ok {
+				log.Fatalf("unknown language '%s', known ones are %s", name, strings.Join(corpus.LanguageNames(), ", "))
+			}
+			languages[language] = true
+		}
+	}
+
+	opts := &corpus.SourceOptions{
+		StripComments:    *stripCommentsParam,
+		StripStrings:     *stripStringsParam,
+		SplitIdentifiers: *splitIdentifiersParam,
+		IdentifierWeight: *identifierWeightParam,
+	}
+
+	// the counts are written to the files the scoring functions read by
+	// default, so don't replace them by accident
+	if !*forceParam {
+		for _, filename := range []string{*monogramsParam, *bigramsParam} {
+			if _, err := os.Stat(filename); err == nil {
+				log.Fatalf("%s already exists, give another file or -force to overwrite it", filename)
+			}
+		}
+	}
+
+	// the files written are not counted, nor other counts lying around,
+	// as they are text files too
+	outputs := map[string]bool{}
+	for _, filename := range []string{*monogramsParam, *bigramsParam} {
+		if abs, err := filepath.Abs(filename); err == nil {
+			outputs[abs] = true
+		}
+	}
+	isCounts := func(path string) bool {
+		if abs, err := filepath.Abs(path); err == nil && outputs[abs] {
+			return true
+		}
+		for _, pattern := range []string{"monograms*.txt", "bigrams*.txt"} {
+			if ok, _ := filepath.Match(pattern, filepath.Base(path)); ok {
+				return true
+			}
+		}
+		return false
+	}
+
+	counts := corpus.NewCounts()
+	counts.Case = kbdlayout.LocaleCase(*localeParam)
+	files := 0
+	for _, root := range flags.Args() {
+		err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				// skip e.g. .git, but not the root itself even if it's "."
+				if path != root && strings.HasPrefix(info.Name(), ".") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+
+			language := corpus.LanguageForFile(path)
+			if language == nil || len(languages) > 0 && !languages[language] || isCounts(path) {
+				return nil
+			}
+			src, err := ioutil.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			counts.AddSource(string(src), language, opts)
+			files++
+			return nil
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	writeCounts(*monogramsParam, counts.WriteMonograms)
+	writeCounts(*bigramsParam, counts.WriteBigrams)
+	fmt.Printf("counted %d files: %d monograms, %d bigrams\n", files, len(counts.Monograms), len(counts.Bigrams))
+}
+
+func writeCounts(filename string, write func(w io.Writer) error) {
+	file, err := os.Create(filename)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := write(file); err != nil {
+		log.Fatal(err)
+	}
+	if err := file.Close(); err != nil {
+		log.Fatal(err)
+	}
+}
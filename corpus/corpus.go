@@ -0,0 +1,113 @@
+package corpus
+
+import "io"
+import "fmt"
+import "sort"
+import "bufio"
+import "unicode"
+
+// Counts of characters and character pairs, which can be written
+// in the format the scoring functions read (monograms.txt, bigrams.txt)
+type Counts struct {
+	Monograms map[rune]uint64
+	Bigrams   map[[2]rune]uint64
+
+	// language specific rules for lowercasing, nil for the default
+	// rules, see kbdlayout.LocaleCase
+	Case unicode.SpecialCase
+
+	// previous character and its weight, for the next bigram.
+	// zero when the next character doesn't follow it when typing
+	prev       rune
+	prevWeight uint64
+}
+
+func NewCounts() *Counts {
+	return &Counts{
+		Monograms: map[rune]uint64{},
+		Bigrams:   map[[2]rune]uint64{},
+	}
+}
+
+// Counts the character and the bigram it makes with the previous one.
+// Whitespace is not counted, as it is not placed on the layout, but it
+// separates the bigrams. A bigram gets the smaller weight of its characters.
+func (c *Counts) Add(r rune, weight uint64) {
+	if unicode.IsSpace(r) || unicode.IsControl(r) {
+		c.Break()
+		return
+	}
+
+	// the scoring functions lowercase characters, so count them that
+	// way too to not have two lines for the same character
+	r = c.Case.ToLower(r)
+
+	c.Monograms[r] += weight
+	if c.prev != 0 {
+		bigramWeight := weight
+		if c.prevWeight < bigramWeight {
+			bigramWeight = c.prevWeight
+		}
+		c.Bigrams[[2]rune{c.prev, r}] += bigramWeight
+	}
+	c.prev = r
+	c.prevWeight = weight
+}
+
+// Counts all the characters of the text
+func (c *Counts) AddText(text string, weight uint64) {
+	for _, r := range text {
+		c.Add(r, weight)
+	}
+}
+
+// Tells that the next character doesn't follow the previous one,
+// so they don't make a bigram
+func (c *Counts) Break() {
+	c.prev = 0
+	c.prevWeight = 0
+}
+
+// Writes the monograms, most frequent first, one per line as "e 5234"
+func (c *Counts) WriteMonograms(w io.Writer) error {
+	monograms := make([]rune, 0, len(c.Monograms))
+	for r := range c.Monograms {
+		monograms = append(monograms, r)
+	}
+	sort.Slice(monograms, func(i, j int) bool {
+		if c.Monograms[monograms[i]] != c.Monograms[monograms[j]] {
+			return c.Monograms[monograms[i]] > c.Monograms[monograms[j]]
+		}
+		return monograms[i] < monograms[j]
+	})
+
+	writer := bufio.NewWriter(w)
+	for _, r := range monograms {
+		fmt.Fprintf(writer, "%c %d\n", r, c.Monograms[r])
+	}
+	return writer.Flush()
+}
+
+// Writes the bigrams, most frequent first, one per line as "es 5234"
+func (c *Counts) WriteBigrams(w io.Writer) error {
+	bigrams := make([][2]rune, 0, len(c.Bigrams))
+	for bigram := range c.Bigrams {
+		bigrams = append(bigrams, bigram)
+	}
+	sort.Slice(bigrams, func(i, j int) bool {
+		a, b := bigrams[i], bigrams[j]
+		if c.Bigrams[a] != c.Bigrams[b] {
+			return c.Bigrams[a] > c.Bigrams[b]
+		}
+		if a[0] != b[0] {
+			return a[0] < b[0]
+		}
+		return a[1] < b[1]
+	})
+
+	writer := bufio.NewWriter(w)
+	for _, bigram := range bigrams {
+		fmt.Fprintf(writer, "%c%c %d\n", bigram[0], bigram[1], c.Bigrams[bigram])
+	}
+	return writer.Flush()
+}
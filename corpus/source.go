@@ -0,0 +1,317 @@
+package corpus
+
+import "sort"
+import "strings"
+import "unicode"
+import "unicode/utf8"
+import "path/filepath"
+
+// Comment and string syntax of a programming language, enough
+// to tell the code apart from the comments and strings
+type Language struct {
+	Name          string
+	Extensions    []string
+	LineComments  []string    // e.g. "//"
+	BlockComments [][2]string // start and end, e.g. "/*", "*/"
+	Strings       []string    // quotes, same for start and end, e.g. `"`
+	RawStrings    []string    // quotes without escapes, e.g. "`" in Go
+	// quotes of character literals only, e.g. ' in Rust, where
+	// the quote also starts lifetimes like 'a
+	Characters []string
+}
+
+var Languages = map[string]*Language{
+	"go": &Language{
+		Name:          "go",
+		Extensions:    []string{".go"},
+		LineComments:  []string{"//"},
+		BlockComments: [][2]string{{"/*", "*/"}},
+		Strings:       []string{`"`, `'`},
+		RawStrings:    []string{"`"},
+	},
+	"c": &Language{
+		Name:          "c",
+		Extensions:    []string{".c", ".h", ".cc", ".cpp", ".hpp", ".java", ".cs", ".swift", ".kt"},
+		LineComments:  []string{"//"},
+		BlockComments: [][2]string{{"/*", "*/"}},
+		Strings:       []string{`"`, `'`},
+	},
+	"rust": &Language{
+		Name:          "rust",
+		Extensions:    []string{".rs"},
+		LineComments:  []string{"//"},
+		BlockComments: [][2]string{{"/*", "*/"}},
+		// ' starts lifetimes like 'a as well as characters, which
+		// would be taken as strings to the end of the line
+		Strings:    []string{`"`},
+		Characters: []string{`'`},
+	},
+	"javascript": &Language{
+		Name:          "javascript",
+		Extensions:    []string{".js", ".jsx", ".ts", ".tsx"},
+		LineComments:  []string{"//"},
+		BlockComments: [][2]string{{"/*", "*/"}},
+		Strings:       []string{`"`, `'`, "`"},
+	},
+	"python": &Language{
+		Name:         "python",
+		Extensions:   []string{".py"},
+		LineComments: []string{"#"},
+		// longer quotes first, so triple quotes are not taken as empty strings
+		Strings: []string{`"""`, `'''`, `"`, `'`},
+	},
+	// prose, e.g. for the corpus of a language preset, where the
+	// words are counted as identifiers
+	"text": &Language{
+		Name:       "text",
+		Extensions: []string{".txt"},
+	},
+	"shell": &Language{
+		Name:         "shell",
+		Extensions:   []string{".sh", ".bash", ".rb", ".pl"},
+		LineComments: []string{"#"},
+		Strings:      []string{`"`, `'`},
+	},
+}
+
+// Returns the names of the languages in alphabetical order
+func LanguageNames() []string {
+	names := make([]string, 0, len(Languages))
+	for name := range Languages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Finds the language by the extension of the file name, nil if unknown
+func LanguageForFile(filename string) *Language {
+	ext := strings.ToLower(filepath.Ext(filename))
+	for _, language := range Languages {
+		for _, e := range language.Extensions {
+			if e == ext {
+				return language
+			}
+		}
+	}
+	return nil
+}
+
+// How source code is counted
+type SourceOptions struct {
+	StripComments bool
+	StripStrings  bool
+
+	// count identifiers as the words they are made of, e.g. parseHTTPRequest
+	// and parse_http_request as parse, http and request. Bigrams are not
+	// counted over the word boundaries.
+	SplitIdentifiers bool
+
+	// multiplier for the characters of identifiers, 0 is the same as 1
+	IdentifierWeight uint64
+}
+
+// Counts the characters of source code in the language
+func (c *Counts) AddSource(src string, language *Language, opts *SourceOptions) {
+	identifierWeight := opts.IdentifierWeight
+	if identifierWeight == 0 {
+		identifierWeight = 1
+	}
+
+	c.Break()
+	for len(src) > 0 {
+		// comments
+		if prefix := hasAnyPrefix(src, language.LineComments); prefix != "" {
+			end := strings.IndexByte(src, '\n')
+			if end < 0 {
+				end = len(src)
+			}
+			c.addOrSkip(src[:end], opts.StripComments)
+			src = src[end:]
+			continue
+		}
+		if block, ok := blockComment(src, language.BlockComments); ok {
+			end := strings.Index(src[len(block[0]):], block[1])
+			if end < 0 {
+				end = len(src)
+			} else {
+				end += len(block[0]) + len(block[1])
+			}
+			c.addOrSkip(src[:end], opts.StripComments)
+			src = src[end:]
+			continue
+		}
+
+		// strings
+		if quote := hasAnyPrefix(src, language.RawStrings); quote != "" {
+			end := stringEnd(src, quote, false)
+			c.addOrSkip(src[:end], opts.StripStrings)
+			src = src[end:]
+			continue
+		}
+		if quote := hasAnyPrefix(src, language.Strings); quote != "" {
+			end := stringEnd(src, quote, true)
+			c.addOrSkip(src[:end], opts.StripStrings)
+			src = src[end:]
+			continue
+		}
+		if quote := hasAnyPrefix(src, language.Characters); quote != "" {
+			if end := characterEnd(src, quote); end > 0 {
+				c.addOrSkip(src[:end], opts.StripStrings)
+				src = src[end:]
+				continue
+			}
+			// e.g. a lifetime, the quote is counted as any other character
+		}
+
+		// identifiers
+		r, size := utf8.DecodeRuneInString(src)
+		if isIdentifierStart(r) {
+			end := size
+			for end < len(src) {
+				r, size := utf8.DecodeRuneInString(src[end:])
+				if !isIdentifierStart(r) && !unicode.IsDigit(r) {
+					break
+				}
+				end += size
+			}
+			c.addIdentifier(src[:end], identifierWeight, opts.SplitIdentifiers)
+			src = src[end:]
+			continue
+		}
+
+		// anything else, e.g. operators, brackets and whitespace
+		c.Add(r, 1)
+		src = src[size:]
+	}
+	c.Break()
+}
+
+// Counts the text unless it should be skipped. Skipped text is
+// replaced with a break, so the text around it doesn't join.
+func (c *Counts) addOrSkip(text string, skip bool) {
+	if skip {
+		c.Break()
+		return
+	}
+	c.AddText(text, 1)
+}
+
+func (c *Counts) addIdentifier(identifier string, weight uint64, split bool) {
+	if !split {
+		c.AddText(identifier, weight)
+		return
+	}
+	for i, word := range splitIdentifier(identifier) {
+		if i > 0 {
+			c.Break()
+		}
+		if word == "_" {
+			// the separators are typed, but they don't belong to the words
+			c.Add('_', weight)
+			continue
+		}
+		c.AddText(word, weight)
+	}
+}
+
+// Splits snake_case and camelCase identifiers into words, keeping the
+// underscores as words of their own. Runs of capitals are kept together,
+// e.g. parseHTTPRequest is parse, HTTP and Request.
+func splitIdentifier(identifier string) []string {
+	var words []string
+	runes := []rune(identifier)
+	start := 0
+	for i := 0; i < len(runes); i++ {
+		if runes[i] == '_' {
+			if start < i {
+				words = append(words, string(runes[start:i]))
+			}
+			words = append(words, "_")
+			start = i + 1
+			continue
+		}
+		if i == start {
+			continue
+		}
+
+		prev := runes[i-1]
+		upper := unicode.IsUpper(runes[i])
+		// lower to upper starts a new word (parse|Http), as does the last
+		// capital of a run followed by lower case (HTTP|Request)
+		if upper && !unicode.IsUpper(prev) ||
+			upper && unicode.IsUpper(prev) && i+1 < len(runes) && unicode.IsLower(runes[i+1]) {
+			words = append(words, string(runes[start:i]))
+			start = i
+		}
+	}
+	if start < len(runes) {
+		words = append(words, string(runes[start:]))
+	}
+	return words
+}
+
+func isIdentifierStart(r rune) bool {
+	return r == '_' || unicode.IsLetter(r)
+}
+
+// Returns the first of the prefixes the text starts with, or empty string
+func hasAnyPrefix(text string, prefixes []string) string {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(text, prefix) {
+			return prefix
+		}
+	}
+	return ""
+}
+
+func blockComment(text string, blocks [][2]string) ([2]string, bool) {
+	for _, block := range blocks {
+		if strings.HasPrefix(text, block[0]) {
+			return block, true
+		}
+	}
+	return [2]string{}, false
+}
+
+// Returns the index after the closing quote of the string starting
+// at the beginning of the text, or the length of the text if the
+// string doesn't end. Single character quotes end at line end too.
+func stringEnd(text string, quote string, escapes bool) int {
+	for i := len(quote); i < len(text); i++ {
+		switch {
+		case escapes && text[i] == '\\':
+			// skip the escaped character
+			i++
+		case strings.HasPrefix(text[i:], quote):
+			return i + len(quote)
+		case text[i] == '\n' && len(quote) == 1 && quote != "`":
+			return i
+		}
+	}
+	return len(text)
+}
+
+// Returns the index after the closing quote of the character literal
+// starting at the beginning of the text, e.g. 'a' or '\n', or 0 if the
+// quote doesn't start one, as in a lifetime like 'a.
+func characterEnd(text string, quote string) int {
+	i := len(quote)
+	if i < len(text) && text[i] == '\\' {
+		// escapes are short, e.g. \' or \u{1F600}
+		for j := i + 2; j < len(text) && j < i+12 && text[j] != '\n'; j++ {
+			if strings.HasPrefix(text[j:], quote) {
+				return j + len(quote)
+			}
+		}
+		return 0
+	}
+	r, size := utf8.DecodeRuneInString(text[i:])
+	if size == 0 || r == '\n' || strings.HasPrefix(text[i:], quote) {
+		return 0
+	}
+	if strings.HasPrefix(text[i+size:], quote) {
+		return i + size + len(quote)
+	}
+	return 0
+}
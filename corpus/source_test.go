@@ -0,0 +1,153 @@
+package corpus
+
+import "reflect"
+import "testing"
+
+func TestSplitIdentifier(t *testing.T) {
+	tests := []struct {
+		identifier string
+		words      []string
+	}{
+		{"parse", []string{"parse"}},
+		{"parseRequest", []string{"parse", "Request"}},
+		{"parseHTTPRequest", []string{"parse", "HTTP", "Request"}},
+		{"ParseHTTP", []string{"Parse", "HTTP"}},
+		{"HTTP", []string{"HTTP"}},
+		{"parse_http_request", []string{"parse", "_", "http", "_", "request"}},
+		{"_private", []string{"_", "private"}},
+		{"trailing_", []string{"trailing", "_"}},
+		{"a__b", []string{"a", "_", "_", "b"}},
+		{"utf8Decode", []string{"utf8", "Decode"}},
+		{"ärgerÜber", []string{"ärger", "Über"}},
+	}
+	for _, test := range tests {
+		if words := splitIdentifier(test.identifier); !reflect.DeepEqual(words, test.words) {
+			t.Errorf("splitIdentifier(%q) = %q, want %q", test.identifier, words, test.words)
+		}
+	}
+}
+
+func TestStringEnd(t *testing.T) {
+	tests := []struct {
+		text    string
+		quote   string
+		escapes bool
+		end     int
+	}{
+		{`"abc" + x`, `"`, true, 5},
+		{`"a\"b" + x`, `"`, true, 6},
+		{`"a\\" + x`, `"`, true, 5},
+		{`"a\"b" + x`, `"`, false, 4},
+		{`"unterminated`, `"`, true, 13},
+		{"\"to the\nline end\"", `"`, true, 7},
+		{"`raw\nlines` + x", "`", false, 11},
+		{`"""doc "quoted" here""" + x`, `"""`, true, 23},
+		{"'''multi\nline''' + x", `'''`, true, 16},
+	}
+	for _, test := range tests {
+		if end := stringEnd(test.text, test.quote, test.escapes); end != test.end {
+			t.Errorf("stringEnd(%q, %q, %v) = %d, want %d", test.text, test.quote, test.escapes, end, test.end)
+		}
+	}
+}
+
+func TestCharacterEnd(t *testing.T) {
+	tests := []struct {
+		text string
+		end  int
+	}{
+		{`'a' + x`, 3},
+		{`'"' + x`, 3},
+		{`'ä' + x`, 4},
+		{`'\n' + x`, 4},
+		{`'\'' + x`, 4},
+		{`'\\' + x`, 4},
+		{`'\u{1F600}' + x`, 11},
+		{`'a>(x: &'a str)`, 0},
+		{`'static str`, 0},
+		{`'outer: loop`, 0},
+		{`''`, 0},
+		{"'\n'", 0},
+		{`'`, 0},
+	}
+	for _, test := range tests {
+		if end := characterEnd(test.text, `'`); end != test.end {
+			t.Errorf("characterEnd(%q) = %d, want %d", test.text, end, test.end)
+		}
+	}
+}
+
+func TestAddSource(t *testing.T) {
+	rust := Languages["rust"]
+	tests := []struct {
+		name      string
+		src       string
+		language  *Language
+		opts      SourceOptions
+		monograms map[rune]uint64
+	}{
+		{
+			name:      "code",
+			src:       "x = y;",
+			language:  Languages["go"],
+			monograms: map[rune]uint64{'x': 1, '=': 1, 'y': 1, ';': 1},
+		},
+		{
+			name:      "stripped comments",
+			src:       "x // note\n/* block */y",
+			language:  Languages["go"],
+			opts:      SourceOptions{StripComments: true},
+			monograms: map[rune]uint64{'x': 1, 'y': 1},
+		},
+		{
+			name:      "stripped strings",
+			src:       "f(\"s, t\", 'u', `v`)",
+			language:  Languages["go"],
+			opts:      SourceOptions{StripStrings: true},
+			monograms: map[rune]uint64{'f': 1, '(': 1, ',': 2, ')': 1},
+		},
+		{
+			name:      "rust character of a quote",
+			src:       `c == '"' && d`,
+			language:  rust,
+			opts:      SourceOptions{StripStrings: true},
+			monograms: map[rune]uint64{'c': 1, '=': 2, '&': 2, 'd': 1},
+		},
+		{
+			name:      "rust lifetime",
+			src:       "fn f<'a>(x: &'a str) -> &'a str",
+			language:  rust,
+			opts:      SourceOptions{StripStrings: true},
+			monograms: map[rune]uint64{'f': 2, 'n': 1, '<': 1, '\'': 3, 'a': 3, '>': 2, '(': 1, 'x': 1, ':': 1, '&': 2, 's': 2, 't': 2, 'r': 2, ')': 1, '-': 1},
+		},
+		{
+			name:      "weighted split identifiers",
+			src:       "getX_y",
+			language:  Languages["go"],
+			opts:      SourceOptions{SplitIdentifiers: true, IdentifierWeight: 2},
+			monograms: map[rune]uint64{'g': 2, 'e': 2, 't': 2, 'x': 2, '_': 2, 'y': 2},
+		},
+		{
+			name:      "text",
+			src:       "It's Ünder",
+			language:  Languages["text"],
+			monograms: map[rune]uint64{'i': 1, 't': 1, '\'': 1, 's': 1, 'ü': 1, 'n': 1, 'd': 1, 'e': 1, 'r': 1},
+		},
+	}
+	for _, test := range tests {
+		counts := NewCounts()
+		counts.AddSource(test.src, test.language, &test.opts)
+		if !reflect.DeepEqual(counts.Monograms, test.monograms) {
+			t.Errorf("%s: monograms of %q are %v, want %v", test.name, test.src, counts.Monograms, test.monograms)
+		}
+	}
+}
+
+func TestAddSourceBigrams(t *testing.T) {
+	counts := NewCounts()
+	counts.AddSource("ab_cd x", Languages["go"], &SourceOptions{SplitIdentifiers: true})
+	want := map[[2]rune]uint64{{'a', 'b'}: 1, {'c', 'd'}: 1}
+	if !reflect.DeepEqual(counts.Bigrams, want) {
+		t.Errorf("bigrams are %v, want %v, none over the word boundaries or whitespace", counts.Bigrams, want)
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import "fmt"
+import "log"
+import "expvar"
+import "net/http"
+import _ "net/http/pprof"
+
+import "./gen"
+
+// Serves the variables of expvar at /debug/vars, with the stats under
+// the name "generator", and the profiles of pprof at /debug/pprof.
+// stats is called on each request.
+func serveDebug(addr string, stats func() interface{}) {
+	expvar.Publish("generator", expvar.Func(stats))
+	fmt.Printf("debug endpoints on http://%s/debug/vars and http://%s/debug/pprof\n", addr, addr)
+	go func() {
+		// both register on the default mux
+		log.Fatal(http.ListenAndServe(addr, nil))
+	}()
+}
+
+// Prints how the workers have spent their time
+func printStats(stats *gen.Stats) {
+	fmt.Printf("\n%-7s %12s %14s %12s %10s %10s %10s %10s %10s\n",
+		"worker", "generations", "evaluations", "evals/s", "scoring", "sorting", "breeding", "waiting", "diversity")
+	print := func(name string, w gen.WorkerStats) {
+		fmt.Printf("%-7s %12d %14d %12.0f %9.2fs %9.2fs %9.2fs %9.2fs %10.3f\n",
+			name, w.Generations, w.Evaluations, w.EvaluationsPerSecond, w.Scoring, w.Sorting, w.Breeding, w.Waiting, w.Diversity)
+	}
+	for _, w := range stats.Workers() {
+		print(fmt.Sprint(w.Worker), w)
+	}
+	print("total", stats.Total())
+}
@@ -0,0 +1,81 @@
+package main
+
+import "fmt"
+import "log"
+import "flag"
+import "strings"
+
+import "./kbdlayout"
+
+// kbdgen diff -a <layout> -b <layout>
+//
+// Shows how two layouts differ and how their scores compare
+func diffCommand(args []string) {
+	flags := flag.NewFlagSet("diff", flag.ExitOnError)
+	var aParam = flags.String("a", "qwerty", "layout to compare from, name or custom (define with 30 characters)")
+	var bParam = flags.String("b", "", "layout to compare to, name or custom (define with 30 characters)")
+	var scoringFuncParam = flags.String("scoring-func", "monogram,bigram", "comma separated list of scoring functions to compare with")
+	common := addCommonFlags(flags)
+	flags.Parse(args)
+	common.apply()
+
+	if *bParam == "" {
+		log.Fatal("diff needs a layout to compare to, use -b")
+	}
+
+	a := findLayout(*aParam, defaultMapping)
+	b := findLayout(*bParam, defaultMapping)
+
+	// grids side by side
+	aRows := defaultMapping.LayoutRows(&a)
+	bRows := defaultMapping.LayoutRows(&b)
+	fmt.Printf("%-16s    %s\n", *aParam, *bParam)
+	for row := 0; row < 3; row++ {
+		fmt.Printf("%-16s    %s\n", aRows[row], bRows[row])
+	}
+
+	// where each character of a is found on b
+	var positions [256]int
+	for i := 0; i < 30; i++ {
+		positions[b[i]] = i
+	}
+
+	fmt.Printf("\n%d keys moved:\n", kbdlayout.MovedKeys(&a, &b))
+	fingerChanges := 0
+	handChanges := 0
+	for i := 0; i < 30; i++ {
+		to := positions[a[i]]
+		if to == i {
+			continue
+		}
+
+		fromFinger := kbdlayout.FingerOf(i)
+		toFinger := kbdlayout.FingerOf(to)
+		var change string
+		switch {
+		case fromFinger.Hand() != toFinger.Hand():
+			handChanges++
+			fingerChanges++
+			change = "other hand"
+		case fromFinger != toFinger:
+			fingerChanges++
+			change = "other finger"
+		default:
+			change = "same finger"
+		}
+
+		fmt.Printf("  %c  %-8s %-12s -> %-8s %-12s  %s\n", defaultMapping.ID2Rune[a[i]],
+			kbdlayout.PositionName(i), fromFinger, kbdlayout.PositionName(to), toFinger, change)
+	}
+	fmt.Printf("\n%d keys changed finger, %d of them changed hand, %d swaps apart\n",
+		fingerChanges, handChanges, kbdlayout.SwapDistance(&a, &b))
+
+	fmt.Printf("\n%-12s %16s %16s %16s\n", "scoring", *aParam, *bParam, "delta")
+	for _, name := range strings.Split(*scoringFuncParam, ",") {
+		sf := lookupScoringFunc(name)
+		sf.Init(defaultMapping)
+		aScore := sf.NormalizeScore(sf.CalculateScore(&a))
+		bScore := sf.NormalizeScore(sf.CalculateScore(&b))
+		fmt.Printf("%-12s %16.12f %16.12f %+16.12f\n", name, aScore, bScore, bScore-aScore)
+	}
+}
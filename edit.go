@@ -0,0 +1,250 @@
+package main
+
+import "os"
+import "fmt"
+import "flag"
+import "sort"
+import "strings"
+import "os/signal"
+
+import "./kbdscoring"
+import "./kbdlayout"
+
+const editHelp = "arrows/hjkl move  space/enter pick and swap  esc cancel  u undo  r reset  e export  q quit"
+
+// number of same finger bigrams listed in the editor
+const editTopSFBs = 5
+
+// kbdgen edit -layout <layout>
+//
+// Edits a layout by swapping keys in the terminal, rescoring it on every swap
+func editCommand(args []string) {
+	flags := flag.NewFlagSet("edit", flag.ExitOnError)
+	var layoutParam = flags.String("layout", "", "name of a layout (see kbdgen list) or custom (define with 30 characters), the baseline of the language preset if empty")
+	var scoringFuncParam = flags.String("scoring-func", "monogram,bigram,composite", "comma separated list of scoring functions to show")
+	var exportParam = flags.String("export", "kbdgen-edited.txt", "file the edited layouts are appended to on export")
+	common := addCommonFlags(flags)
+	flags.Parse(args)
+	common.apply()
+
+	if *layoutParam == "" {
+		*layoutParam = activePreset.baseline
+	}
+	// similarity tells how far the edits have gone
+	similarityScoringFunc.Reference = findLayoutString(*layoutParam)
+
+	e := &editor{
+		original:   findLayout(*layoutParam, defaultMapping),
+		exportFile: *exportParam,
+		marked:     -1,
+	}
+	e.layout = e.original
+	for _, name := range strings.Split(*scoringFuncParam, ",") {
+		sf := lookupScoringFunc(name)
+		sf.Init(defaultMapping)
+		e.names = append(e.names, name)
+		e.sfs = append(e.sfs, sf)
+	}
+	// for the same finger bigrams
+	bigramScoringFunc.Init(defaultMapping)
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, os.Kill)
+
+	restore := enterTerminal()
+	var keys <-chan rune = readKeys()
+	e.draw()
+
+loop:
+	for {
+		select {
+		case <-quit:
+			break loop
+		case key, ok := <-keys:
+			if !ok || key == 'q' {
+				break loop
+			}
+			e.handleKey(key)
+			e.draw()
+		}
+	}
+	restore()
+
+	defaultMapping.PrintLayout(&e.layout)
+	fmt.Println(defaultMapping.LayoutString(&e.layout))
+	for i, sf := range e.sfs {
+		fmt.Printf("%-12s %s\n", e.names[i], formatScore(sf, sf.CalculateScore(&e.layout), false))
+	}
+}
+
+// State of the layout editor
+type editor struct {
+	original   kbdlayout.KeyboardLayout
+	layout     kbdlayout.KeyboardLayout
+	undo       []kbdlayout.KeyboardLayout // layouts before each change
+	exportFile string
+
+	names []string // of the scoring funcs
+	sfs   []kbdscoring.ScoringFunction
+
+	cursor  int
+	marked  int // position picked for swapping, -1 if none
+	message string
+}
+
+func (e *editor) handleKey(key rune) {
+	e.message = ""
+	switch key {
+	case 'h':
+		if e.cursor%10 > 0 {
+			e.cursor--
+		}
+	case 'l':
+		if e.cursor%10 < 9 {
+			e.cursor++
+		}
+	case 'k':
+		if e.cursor >= 10 {
+			e.cursor -= 10
+		}
+	case 'j':
+		if e.cursor < 20 {
+			e.cursor += 10
+		}
+	case ' ', '\n', '\r':
+		if e.marked < 0 {
+			e.marked = e.cursor
+			return
+		}
+		if e.marked != e.cursor {
+			e.undo = append(e.undo, e.layout)
+			e.layout[e.marked], e.layout[e.cursor] = e.layout[e.cursor], e.layout[e.marked]
+			e.message = fmt.Sprintf("swapped '%c' and '%c'",
+				defaultMapping.ID2Rune[e.layout[e.cursor]], defaultMapping.ID2Rune[e.layout[e.marked]])
+		}
+		e.marked = -1
+	case 0x1b:
+		e.marked = -1
+	case 'u':
+		if len(e.undo) == 0 {
+			e.message = "nothing to undo"
+			return
+		}
+		e.layout = e.undo[len(e.undo)-1]
+		e.undo = e.undo[:len(e.undo)-1]
+		e.marked = -1
+	case 'r':
+		if e.layout != e.original {
+			e.undo = append(e.undo, e.layout)
+			e.layout = e.original
+		}
+		e.marked = -1
+	case 'e':
+		if err := e.export(); err != nil {
+			e.message = err.Error()
+			return
+		}
+		e.message = "exported to " + e.exportFile
+	}
+}
+
+// Appends the layout to the export file in the format of -hof-export,
+// with the score of the first scoring func
+func (e *editor) export() error {
+	file, err := os.OpenFile(e.exportFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	sf := e.sfs[0]
+	fmt.Fprintf(file, "%.12f %s\n", sf.NormalizeScore(sf.CalculateScore(&e.layout)), defaultMapping.LayoutString(&e.layout))
+	return file.Close()
+}
+
+func (e *editor) draw() {
+	var b strings.Builder
+	line := func(format string, args ...interface{}) {
+		fmt.Fprintf(&b, format, args...)
+		b.WriteString("\x1b[K\n")
+	}
+	b.WriteString("\x1b[H")
+
+	line("kbdgen edit  %s", defaultMapping.LayoutString(&e.layout))
+	line("")
+	for row := 0; row < 3; row++ {
+		var keys strings.Builder
+		for col := 0; col < 10; col++ {
+			pos := row*10 + col
+			if col == 5 {
+				keys.WriteString("  ")
+			}
+			key := fmt.Sprintf(" %c ", defaultMapping.ID2Rune[e.layout[pos]])
+			if pos == e.marked {
+				key = fmt.Sprintf("[%c]", defaultMapping.ID2Rune[e.layout[pos]])
+			}
+			if e.layout[pos] != e.original[pos] {
+				// moved keys are underlined
+				key = "\x1b[4m" + key + "\x1b[24m"
+			}
+			if pos == e.cursor {
+				key = "\x1b[7m" + key + "\x1b[27m"
+			}
+			keys.WriteString(key)
+		}
+		line("    %s", keys.String())
+	}
+	line("")
+	line("%d keys moved, %d swaps from the original", kbdlayout.MovedKeys(&e.layout, &e.original), kbdlayout.SwapDistance(&e.layout, &e.original))
+	line("")
+
+	line("%-12s %16s %16s", "scoring", "score", "change")
+	for i, sf := range e.sfs {
+		score := sf.NormalizeScore(sf.CalculateScore(&e.layout))
+		original := sf.NormalizeScore(sf.CalculateScore(&e.original))
+		line("%-12s %16.12f %+16.12f", e.names[i], score, score-original)
+	}
+	line("")
+
+	sfb, originalSFB, worst := e.sameFingerBigrams()
+	line("same finger bigrams %6.2f%% (%+.2f%%)", sfb, sfb-originalSFB)
+	for _, c := range worst {
+		line("  %c%c %10d  %s -> %s  %s", defaultMapping.ID2Rune[c.First], defaultMapping.ID2Rune[c.Second], c.Frequency,
+			kbdlayout.PositionName(c.FirstPos), kbdlayout.PositionName(c.SecondPos), kbdlayout.FingerOf(c.FirstPos))
+	}
+	line("")
+	line("%s", editHelp)
+	line("%s", e.message)
+	b.WriteString("\x1b[J")
+	os.Stdout.WriteString(b.String())
+}
+
+// Returns the share of bigrams typed with the same finger on two different
+// keys on the layout and on the original, in percent, with the most common
+// same finger bigrams of the layout
+func (e *editor) sameFingerBigrams() (float64, float64, []kbdscoring.BigramContribution) {
+	share := func(layout *kbdlayout.KeyboardLayout) (float64, []kbdscoring.BigramContribution) {
+		var total, same uint64
+		var sfbs []kbdscoring.BigramContribution
+		for _, c := range bigramScoringFunc.Explain(layout) {
+			total += c.Frequency
+			if c.FirstPos != c.SecondPos && kbdlayout.FingerOf(c.FirstPos) == kbdlayout.FingerOf(c.SecondPos) {
+				same += c.Frequency
+				sfbs = append(sfbs, c)
+			}
+		}
+		if total == 0 {
+			return 0, nil
+		}
+		return 100 * float64(same) / float64(total), sfbs
+	}
+
+	sfb, sfbs := share(&e.layout)
+	originalSFB, _ := share(&e.original)
+
+	sort.Slice(sfbs, func(i, j int) bool {
+		return sfbs[i].Frequency > sfbs[j].Frequency
+	})
+	if len(sfbs) > editTopSFBs {
+		sfbs = sfbs[:editTopSFBs]
+	}
+	return sfb, originalSFB, sfbs
+}
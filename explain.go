@@ -0,0 +1,64 @@
+package main
+
+import "fmt"
+import "log"
+import "flag"
+import "sort"
+
+import "./kbdscoring"
+import "./kbdlayout"
+
+// kbdgen explain -layout <layout>
+//
+// Shows which bigrams make the bigram score of a layout
+func explainCommand(args []string) {
+	flags := flag.NewFlagSet("explain", flag.ExitOnError)
+	var layoutParam = flags.String("layout", "", "name of a layout (see kbdgen list) or custom (define with 30 characters)")
+	var topParam = flags.Int("top", 20, "number of bigrams to show in each list")
+	common := addCommonFlags(flags)
+	flags.Parse(args)
+	common.apply()
+
+	if *layoutParam == "" {
+		log.Fatal("explain needs a layout, use -layout")
+	}
+
+	sf := bigramScoringFunc
+	sf.Init(defaultMapping)
+	layout := findLayout(*layoutParam, defaultMapping)
+	score := sf.CalculateScore(&layout)
+
+	defaultMapping.PrintLayout(&layout)
+	fmt.Printf("bigram score %16.12f (raw %d)\n", sf.NormalizeScore(score), score)
+
+	contributions := sf.Explain(&layout)
+
+	sort.Slice(contributions, func(i, j int) bool {
+		return contributions[i].Score > contributions[j].Score
+	})
+	fmt.Printf("\ntop contributing bigrams:\n")
+	printContributions(contributions, *topParam, score)
+
+	sort.Slice(contributions, func(i, j int) bool {
+		return contributions[i].Penalty > contributions[j].Penalty
+	})
+	fmt.Printf("\nworst penalised bigrams (score lost compared to the best weight):\n")
+	printContributions(contributions, *topParam, score)
+}
+
+func printContributions(contributions []kbdscoring.BigramContribution, top int, total uint64) {
+	fmt.Printf("  %-6s %12s %6s %12s %12s %7s  %s\n", "bigram", "frequency", "weight", "score", "penalty", "share", "keys")
+	for i := 0; i < top && i < len(contributions); i++ {
+		c := contributions[i]
+		// a corpus without any of the bigrams scores 0, then no bigram has a share
+		var share float64
+		if total > 0 {
+			share = 100 * float64(c.Score) / float64(total)
+		}
+		fmt.Printf("  %c%c     %12d %6d %12d %12d %6.2f%%  %s (%s) -> %s (%s)\n",
+			defaultMapping.ID2Rune[c.First], defaultMapping.ID2Rune[c.Second],
+			c.Frequency, c.Weight, c.Score, c.Penalty, share,
+			kbdlayout.PositionName(c.FirstPos), kbdlayout.FingerOf(c.FirstPos),
+			kbdlayout.PositionName(c.SecondPos), kbdlayout.FingerOf(c.SecondPos))
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import "fmt"
+import "log"
+import "flag"
+
+import "./kbdscoring"
+
+// Flags shared by the commands, configuring the language,
+// the layout library and the scoring functions
+type commonFlags struct {
+	lang               *string
+	layoutDirs         *string
+	monograms          *string
+	bigrams            *string
+	baseline           *string
+	similarityWeighted *bool
+	composite          *string
+}
+
+func addCommonFlags(flags *flag.FlagSet) *commonFlags {
+	return &commonFlags{
+		lang:               flags.String("lang", "en", "language preset for the characters, corpus and baseline: en/fi/de/fr"),
+		monograms:          flags.String("monograms", "", "monogram counts, the corpus of the language preset if empty"),
+		bigrams:            flags.String("bigrams", "", "bigram counts, the corpus of the language preset if empty"),
+		layoutDirs:         flags.String("layout-dirs", "", "comma separated directories of layout files to load after the ones in "+defaultLayoutDir),
+		baseline:           flags.String("baseline", "", "layout that gets the normalized score 1.0, name or custom (define with 30 characters), the one of the language preset if empty"),
+		similarityWeighted: flags.Bool("similarity-weighted", false, "weight the similarity of characters by their frequency in the monograms"),
+		composite:          flags.String("composite", "bigram:1", "weighted scoring functions for the composite scoring func, e.g. bigram:1,similarity:0.2,monogram:-0.1"),
+	}
+}
+
+// Activates the language preset and loads the layouts, for the
+// commands that don't score. Has to be called after parsing the flags.
+func (f *commonFlags) applyLibrary() {
+	usePreset(*f.lang)
+	loadLibrary(*f.layoutDirs)
+}
+
+// Loads the layouts and configures the scoring functions with
+// the flags. Has to be called after parsing the flags and before
+// using the layouts or the scoring functions.
+func (f *commonFlags) apply() {
+	f.applyLibrary()
+
+	// files and layouts not given default to the ones of the preset
+	if *f.monograms == "" {
+		*f.monograms = activePreset.monograms
+	}
+	if *f.bigrams == "" {
+		*f.bigrams = activePreset.bigrams
+	}
+	if *f.baseline == "" {
+		*f.baseline = activePreset.baseline
+	}
+
+	kbdscoring.MissingCountsHint = presetCorpusHint
+	monogramScoringFunc.File = *f.monograms
+	bigramScoringFunc.File = *f.bigrams
+	similarityScoringFunc.Monograms = *f.monograms
+	similarityScoringFunc.Weighted = *f.similarityWeighted
+
+	baseline := findLayoutString(*f.baseline)
+	for _, sf := range scoringFuncs {
+		if baseliner, ok := sf.(kbdscoring.Baseliner); ok {
+			baseliner.SetBaseline(baseline)
+		}
+	}
+
+	terms, err := parseComposite(*f.composite)
+	if err != nil {
+		log.Fatal(err)
+	}
+	compositeScoringFunc.Terms = terms
+}
+
+// Returns instructions for counting the corpus of the preset if the
+// file is one of its files, as they are not shipped with kbdgen
+func presetCorpusHint(filename string) string {
+	if filename != activePreset.monograms && filename != activePreset.bigrams {
+		return ""
+	}
+	return fmt.Sprintf("the %s preset needs its corpus, count it from %s text with\n"+
+		"  kbdgen corpus -languages text -locale %s -monograms %s -bigrams %s <dir>\n"+
+		"or give the corpus with -monograms and -bigrams",
+		activePreset.title, activePreset.title, activePreset.locale, activePreset.monograms, activePreset.bigrams)
+}
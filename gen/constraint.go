@@ -0,0 +1,173 @@
+package gen
+
+import "sync"
+import "math/rand"
+
+import "../kbdlayout"
+
+// Constraint restricts the layouts the generator may produce
+type Constraint interface {
+	// Returns true if the layout satisfies the constraint
+	Allows(layout *kbdlayout.KeyboardLayout) bool
+
+	// Changes the layout, as little as possible,
+	// so that it satisfies the constraint. Random choices are taken
+	// from rng, the random numbers of the worker, so that a run with
+	// Options.Seed set can be repeated. The global source of math/rand
+	// would be shared by all the workers in whatever order they run.
+	Enforce(rng *rand.Rand, layout *kbdlayout.KeyboardLayout)
+}
+
+// Allows at most Max keys to be in a different position
+// than on the Reference layout
+type MaxMovedKeys struct {
+	Reference kbdlayout.KeyboardLayout
+	Max       int
+}
+
+func (c *MaxMovedKeys) Allows(layout *kbdlayout.KeyboardLayout) bool {
+	return kbdlayout.MovedKeys(layout, &c.Reference) <= c.Max
+}
+
+// Puts randomly chosen moved keys back to their reference positions
+// until there are few enough of them
+func (c *MaxMovedKeys) Enforce(rng *rand.Rand, layout *kbdlayout.KeyboardLayout) {
+	var moved []int
+	for i := 0; i < 30; i++ {
+		if layout[i] != c.Reference[i] {
+			moved = append(moved, i)
+		}
+	}
+
+	for len(moved) > c.Max {
+		idx := rng.Intn(len(moved))
+		pos := moved[idx]
+
+		// swap the character that belongs to pos back from where it
+		// is now, which may fix that position too
+		for other := 0; other < 30; other++ {
+			if layout[other] == c.Reference[pos] {
+				layout[pos], layout[other] = layout[other], layout[pos]
+				break
+			}
+		}
+
+		// start over, as more than one position may have been fixed
+		moved = moved[:0]
+		for i := 0; i < 30; i++ {
+			if layout[i] != c.Reference[i] {
+				moved = append(moved, i)
+			}
+		}
+	}
+}
+
+// Returns true if the layout satisfies all of the constraints
+func allowed(layout *kbdlayout.KeyboardLayout, constraints []Constraint) bool {
+	for _, constraint := range constraints {
+		if !constraint.Allows(layout) {
+			return false
+		}
+	}
+	return true
+}
+
+// rounds of enforcing the constraints before giving up on them
+const enforceRounds = 100
+
+// Makes the layout satisfy all of the constraints. Enforcing one can
+// break another, e.g. pinning a key can move one more key than allowed,
+// so they are enforced until all of them hold. Returns false if they
+// still don't after enforceRounds, as when they contradict each other.
+func enforce(rng *rand.Rand, layout *kbdlayout.KeyboardLayout, constraints []Constraint) bool {
+	for round := 0; round < enforceRounds; round++ {
+		if allowed(layout, constraints) {
+			return true
+		}
+		for _, constraint := range constraints {
+			if !constraint.Allows(layout) {
+				constraint.Enforce(rng, layout)
+			}
+		}
+	}
+	return allowed(layout, constraints)
+}
+
+// Scores 0 the layouts of the population that the constraints could
+// not be enforced on, so they are neither parents nor the best
+func rejectDisallowed(population []LayoutEntry, constraints []Constraint) {
+	for i := range population {
+		if !allowed(&population[i].Layout, constraints) {
+			population[i].Score = 0
+		}
+	}
+}
+
+// Keeps characters in the positions they are pinned to. Unlike the
+// other constraints, keys can be pinned and unpinned while the
+// generator is running.
+type Pins struct {
+	mutex  sync.RWMutex
+	pinned map[int]uint8 // character id by position
+}
+
+func NewPins() *Pins {
+	return &Pins{pinned: map[int]uint8{}}
+}
+
+// Pins the character to the position, replacing any other character
+// pinned there. The character must not be pinned to another position.
+func (p *Pins) Pin(pos int, charId uint8) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.pinned[pos] = charId
+}
+
+func (p *Pins) Unpin(pos int) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	delete(p.pinned, pos)
+}
+
+// Returns the character pinned to the position, if any
+func (p *Pins) Pinned(pos int) (uint8, bool) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	charId, ok := p.pinned[pos]
+	return charId, ok
+}
+
+// Returns the number of pinned keys
+func (p *Pins) Len() int {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return len(p.pinned)
+}
+
+func (p *Pins) Allows(layout *kbdlayout.KeyboardLayout) bool {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	for pos, charId := range p.pinned {
+		if layout[pos] != charId {
+			return false
+		}
+	}
+	return true
+}
+
+// Swaps the pinned characters to their positions
+func (p *Pins) Enforce(rng *rand.Rand, layout *kbdlayout.KeyboardLayout) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	for pos, charId := range p.pinned {
+		if layout[pos] == charId {
+			continue
+		}
+		for other := 0; other < 30; other++ {
+			if layout[other] == charId {
+				layout[pos], layout[other] = layout[other], layout[pos]
+				break
+			}
+		}
+	}
+}
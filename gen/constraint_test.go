@@ -0,0 +1,62 @@
+package gen
+
+import "testing"
+import "math/rand"
+
+import "../kbdlayout"
+
+func TestEnforcePinsWithinMaxMovedKeys(t *testing.T) {
+	var reference kbdlayout.KeyboardLayout
+	for i := range reference {
+		reference[i] = uint8(i)
+	}
+	for seed := int64(0); seed < 1000; seed++ {
+		rng := rand.New(rand.NewSource(seed))
+
+		// pinning moves keys from the reference, which the max has to allow
+		pins := NewPins()
+		pins.Pin(0, 1)
+		pins.Pin(1, 0)
+		pins.Pin(29, 15)
+		constraints := []Constraint{&MaxMovedKeys{Reference: reference, Max: 6}, pins}
+
+		var layout kbdlayout.KeyboardLayout
+		randomizeLayout(rng, &layout)
+		if !enforce(rng, &layout, constraints) || !allowed(&layout, constraints) {
+			t.Fatalf("seed %d: %v breaks the constraints after enforcing them", seed, layout)
+		}
+		if !isPermutation(&layout) {
+			t.Fatalf("seed %d: %v is not a permutation", seed, layout)
+		}
+	}
+}
+
+func TestEnforceContradictingConstraints(t *testing.T) {
+	var reference kbdlayout.KeyboardLayout
+	for i := range reference {
+		reference[i] = uint8(i)
+	}
+	pins := NewPins()
+	pins.Pin(0, 1)
+	pins.Pin(1, 0)
+	// pinning 0 and 1 moves two keys
+	constraints := []Constraint{&MaxMovedKeys{Reference: reference, Max: 1}, pins}
+
+	rng := rand.New(rand.NewSource(1))
+	var layout kbdlayout.KeyboardLayout
+	randomizeLayout(rng, &layout)
+	if enforce(rng, &layout, constraints) {
+		t.Errorf("enforced contradicting constraints on %v", layout)
+	}
+
+	pinned := reference
+	pinned[0], pinned[1] = 1, 0
+	population := []LayoutEntry{{Layout: pinned, Score: 100}, {Layout: reference, Score: 50}}
+	rejectDisallowed(population, []Constraint{pins})
+	if population[0].Score != 100 {
+		t.Errorf("layout keeping the pins was scored %d, want 100", population[0].Score)
+	}
+	if population[1].Score != 0 {
+		t.Errorf("layout breaking the pins kept its score %d", population[1].Score)
+	}
+}
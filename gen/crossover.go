@@ -0,0 +1,178 @@
+package gen
+
+import "fmt"
+import "sort"
+import "math/rand"
+
+import "../kbdlayout"
+
+// Crossover creates a child from two parents. The parents are
+// permutations of the same character ids and so must be the child.
+// Random choices are taken from rng, the random numbers of the worker,
+// for the same reason as in Constraint.Enforce.
+type Crossover interface {
+	Cross(rng *rand.Rand, child, parent1, parent2 *kbdlayout.KeyboardLayout)
+}
+
+// Adapter to use plain functions as a Crossover
+type CrossoverFunc func(rng *rand.Rand, child, parent1, parent2 *kbdlayout.KeyboardLayout)
+
+func (f CrossoverFunc) Cross(rng *rand.Rand, child, parent1, parent2 *kbdlayout.KeyboardLayout) {
+	f(rng, child, parent1, parent2)
+}
+
+// Crossovers selectable by name
+var Crossovers = map[string]Crossover{
+	"mix": CrossoverFunc(mix),
+	"pmx": CrossoverFunc(partiallyMappedCrossover),
+	"ox":  CrossoverFunc(orderCrossover),
+	"cx":  CrossoverFunc(cycleCrossover),
+	"pbx": CrossoverFunc(positionBasedCrossover),
+}
+
+// Returns the names of the crossovers in alphabetical order
+func CrossoverNames() []string {
+	names := make([]string, 0, len(Crossovers))
+	for name := range Crossovers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Finds a crossover by its name
+func LookupCrossover(name string) (Crossover, error) {
+	crossover, ok := Crossovers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown crossover '%s', use one of %v", name, CrossoverNames())
+	}
+	return crossover, nil
+}
+
+// Returns random start and end (inclusive) of a segment in the layout
+func randomSegment(rng *rand.Rand) (int, int) {
+	start := rng.Intn(30)
+	end := rng.Intn(30)
+	if start > end {
+		start, end = end, start
+	}
+	return start, end
+}
+
+// Partially mapped crossover (PMX)
+//
+// A random segment is copied from parent1, the rest is taken from
+// parent2. When a character from parent2 is already in the segment,
+// it is replaced with the character parent2 has in the position the
+// conflicting character has in parent1, until there is no conflict.
+func partiallyMappedCrossover(rng *rand.Rand, child, parent1, parent2 *kbdlayout.KeyboardLayout) {
+	start, end := randomSegment(rng)
+
+	// position of each character on parent1
+	var positions [256]int
+	for i := 0; i < 30; i++ {
+		positions[parent1[i]] = i
+	}
+
+	var inSegment [256]bool
+	for i := start; i <= end; i++ {
+		child[i] = parent1[i]
+		inSegment[parent1[i]] = true
+	}
+
+	for i := 0; i < 30; i++ {
+		if i >= start && i <= end {
+			continue
+		}
+		charId := parent2[i]
+		for inSegment[charId] {
+			charId = parent2[positions[charId]]
+		}
+		child[i] = charId
+	}
+}
+
+// Order crossover (OX)
+//
+// A random segment is copied from parent1, the rest of the positions
+// are filled after the segment (wrapping around) with the characters
+// missing from it in the order they appear on parent2 after the segment.
+func orderCrossover(rng *rand.Rand, child, parent1, parent2 *kbdlayout.KeyboardLayout) {
+	start, end := randomSegment(rng)
+
+	var used [256]bool
+	for i := start; i <= end; i++ {
+		child[i] = parent1[i]
+		used[parent1[i]] = true
+	}
+
+	pos := (end + 1) % 30
+	for i := 0; i < 30; i++ {
+		charId := parent2[(end+1+i)%30]
+		if used[charId] {
+			continue
+		}
+		child[pos] = charId
+		pos = (pos + 1) % 30
+	}
+}
+
+// Cycle crossover (CX)
+//
+// The positions are divided into cycles, where the character of parent2
+// on each position is found from parent1 in the next position of the
+// cycle. Every position of a cycle takes the character from the same
+// parent, alternating between the parents from one cycle to the next.
+// Every character stays in a position it has on one of the parents.
+func cycleCrossover(rng *rand.Rand, child, parent1, parent2 *kbdlayout.KeyboardLayout) {
+	var positions [256]int
+	for i := 0; i < 30; i++ {
+		positions[parent1[i]] = i
+	}
+
+	// randomize which parent starts, so that the first
+	// position doesn't always come from parent1
+	parents := [2]*kbdlayout.KeyboardLayout{parent1, parent2}
+	p := rng.Intn(2)
+
+	var visited [30]bool
+	for start := 0; start < 30; start++ {
+		if visited[start] {
+			continue
+		}
+		for pos := start; !visited[pos]; pos = positions[parent2[pos]] {
+			visited[pos] = true
+			child[pos] = parents[p][pos]
+		}
+		p = 1 - p
+	}
+}
+
+// Position based crossover (PBX)
+//
+// Random positions are copied from parent1, the other positions are filled
+// with the missing characters in the order they appear on parent2.
+func positionBasedCrossover(rng *rand.Rand, child, parent1, parent2 *kbdlayout.KeyboardLayout) {
+	var used [256]bool
+	var taken [30]bool
+	for i := 0; i < 30; i++ {
+		if rng.Intn(2) == 0 {
+			child[i] = parent1[i]
+			used[parent1[i]] = true
+			taken[i] = true
+		}
+	}
+
+	pos := 0
+	for i := 0; i < 30; i++ {
+		charId := parent2[i]
+		if used[charId] {
+			continue
+		}
+		for taken[pos] {
+			pos++
+		}
+		child[pos] = charId
+		pos++
+	}
+}
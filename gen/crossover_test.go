@@ -0,0 +1,50 @@
+package gen
+
+import "testing"
+import "math/rand"
+
+import "../kbdlayout"
+
+// Checks that the layout has each of the character ids 0..29 once
+func isPermutation(layout *kbdlayout.KeyboardLayout) bool {
+	var seen [30]bool
+	for _, charId := range layout {
+		if charId >= 30 || seen[charId] {
+			return false
+		}
+		seen[charId] = true
+	}
+	return true
+}
+
+func TestCrossoversMakePermutations(t *testing.T) {
+	for name, crossover := range Crossovers {
+		for seed := int64(0); seed < 1000; seed++ {
+			rng := rand.New(rand.NewSource(seed))
+
+			var random1, random2, reversed kbdlayout.KeyboardLayout
+			randomizeLayout(rng, &random1)
+			randomizeLayout(rng, &random2)
+			for i := range reversed {
+				reversed[i] = random1[29-i]
+			}
+
+			parents := []struct {
+				kind             string
+				parent1, parent2 *kbdlayout.KeyboardLayout
+			}{
+				{"random", &random1, &random2},
+				{"identical", &random1, &random1},
+				{"reversed", &random1, &reversed},
+			}
+			for _, p := range parents {
+				var child kbdlayout.KeyboardLayout
+				crossover.Cross(rng, &child, p.parent1, p.parent2)
+				if !isPermutation(&child) {
+					t.Fatalf("%s with %s parents %v and %v, seed %d: child %v is not a permutation",
+						name, p.kind, *p.parent1, *p.parent2, seed, child)
+				}
+			}
+		}
+	}
+}
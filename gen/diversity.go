@@ -0,0 +1,32 @@
+package gen
+
+import "math"
+
+// Returns how different the layouts of the population are from each
+// other, from 0 when they are all the same to 1 when every character is
+// as likely to be on every position. Measured as the entropy of the
+// characters on each position, averaged over the positions.
+func populationDiversity(population []LayoutEntry) float64 {
+	if len(population) < 2 {
+		return 0
+	}
+
+	var entropy float64
+	for pos := 0; pos < 30; pos++ {
+		var counts [256]int
+		for i := range population {
+			counts[population[i].Layout[pos]]++
+		}
+		for _, count := range counts {
+			if count > 0 {
+				p := float64(count) / float64(len(population))
+				entropy -= p * math.Log(p)
+			}
+		}
+	}
+
+	// the most a position can have is when the characters are spread
+	// evenly, up to the size of the population
+	max := math.Log(math.Min(30, float64(len(population))))
+	return entropy / 30 / max
+}
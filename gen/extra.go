@@ -0,0 +1,41 @@
+package gen
+
+import "../kbdlayout"
+import "../kbdscoring"
+
+// Places the characters on the extra keys of kbdlayout.ExtraKeys along
+// with the 30 keys of the layout, extra[i] being on the extra key i. The
+// characters are swapped between the extra keys, and between the extra
+// keys and the layout, until no swap improves the score, so a character
+// of the layout moves to an extra key if one there is worth more on the
+// 30 keys. Swaps that break any of the constraints are skipped.
+//
+// Changes the layout and extra in place, there can be at most as many
+// extra characters as extra keys. Returns the score with the extra keys.
+func PlaceExtraKeys(sf kbdscoring.ExtraKeysScoringFunction, layout *kbdlayout.KeyboardLayout, extra []uint8, constraints ...Constraint) uint64 {
+	best := sf.CalculateExtraScore(layout, extra)
+	for improved := true; improved; {
+		improved = false
+		for i := range extra {
+			for j := i + 1; j < len(extra); j++ {
+				extra[i], extra[j] = extra[j], extra[i]
+				if score := sf.CalculateExtraScore(layout, extra); score > best {
+					best = score
+					improved = true
+				} else {
+					extra[i], extra[j] = extra[j], extra[i]
+				}
+			}
+			for pos := 0; pos < 30; pos++ {
+				extra[i], layout[pos] = layout[pos], extra[i]
+				if score := sf.CalculateExtraScore(layout, extra); score > best && allowed(layout, constraints) {
+					best = score
+					improved = true
+				} else {
+					extra[i], layout[pos] = layout[pos], extra[i]
+				}
+			}
+		}
+	}
+	return best
+}
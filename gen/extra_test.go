@@ -0,0 +1,109 @@
+package gen
+
+import "testing"
+import "math/rand"
+
+import "../kbdlayout"
+
+// Scores each character on each position, 30+i being the extra key i
+type positionValues struct {
+	values [34][34]uint64 // by position and character
+}
+
+func (sf *positionValues) Init(mapping *kbdlayout.KeyboardMapping) {}
+
+func (sf *positionValues) CalculateScore(layout *kbdlayout.KeyboardLayout) uint64 {
+	return sf.CalculateExtraScore(layout, nil)
+}
+
+func (sf *positionValues) CalculateExtraScore(layout *kbdlayout.KeyboardLayout, extra []uint8) uint64 {
+	var score uint64
+	for pos, charId := range layout {
+		score += sf.values[pos][charId]
+	}
+	for i, charId := range extra {
+		score += sf.values[30+i][charId]
+	}
+	return score
+}
+
+func (sf *positionValues) NormalizeScore(score uint64) float64 {
+	return float64(score)
+}
+
+// Returns the characters on the layout and the extra keys in a set
+func placedCharacters(layout *kbdlayout.KeyboardLayout, extra []uint8) map[uint8]bool {
+	characters := map[uint8]bool{}
+	for _, charId := range layout {
+		characters[charId] = true
+	}
+	for _, charId := range extra {
+		characters[charId] = true
+	}
+	return characters
+}
+
+func TestPlaceExtraKeys(t *testing.T) {
+	for seed := int64(0); seed < 100; seed++ {
+		rng := rand.New(rand.NewSource(seed))
+		sf := &positionValues{}
+		for pos := range sf.values {
+			for charId := range sf.values[pos] {
+				sf.values[pos][charId] = uint64(rng.Intn(1000))
+			}
+		}
+
+		var layout kbdlayout.KeyboardLayout
+		randomizeLayout(rng, &layout)
+		extra := []uint8{30, 31, 32, 33}[:1+rng.Intn(4)]
+		characters := placedCharacters(&layout, extra)
+
+		score := PlaceExtraKeys(sf, &layout, extra)
+		if score != sf.CalculateExtraScore(&layout, extra) {
+			t.Fatalf("seed %d: returned score %d, the placement scores %d", seed, score, sf.CalculateExtraScore(&layout, extra))
+		}
+		if placed := placedCharacters(&layout, extra); len(placed) != len(characters) {
+			t.Fatalf("seed %d: placed %d different characters, want %d", seed, len(placed), len(characters))
+		}
+
+		// no swap is left that improves the score
+		for i := range extra {
+			for pos := 0; pos < 30; pos++ {
+				extra[i], layout[pos] = layout[pos], extra[i]
+				if sf.CalculateExtraScore(&layout, extra) > score {
+					t.Fatalf("seed %d: swapping extra key %d with position %d improves the score", seed, i, pos)
+				}
+				extra[i], layout[pos] = layout[pos], extra[i]
+			}
+			for j := i + 1; j < len(extra); j++ {
+				extra[i], extra[j] = extra[j], extra[i]
+				if sf.CalculateExtraScore(&layout, extra) > score {
+					t.Fatalf("seed %d: swapping extra keys %d and %d improves the score", seed, i, j)
+				}
+				extra[i], extra[j] = extra[j], extra[i]
+			}
+		}
+	}
+}
+
+func TestPlaceExtraKeysMovesToLayout(t *testing.T) {
+	sf := &positionValues{}
+	// the extra character is worth the most on the home row
+	sf.values[12][30] = 1000
+
+	var layout kbdlayout.KeyboardLayout
+	for i := range layout {
+		layout[i] = uint8(i)
+	}
+	original := layout
+	extra := []uint8{30}
+
+	constraints := []Constraint{&MaxMovedKeys{Reference: original, Max: 0}}
+	if PlaceExtraKeys(sf, &layout, extra, constraints...); layout != original || extra[0] != 30 {
+		t.Errorf("moved the extra character to %v with no keys allowed to move", layout)
+	}
+
+	if score := PlaceExtraKeys(sf, &layout, extra); score != 1000 || layout[12] != 30 || extra[0] != 12 {
+		t.Errorf("placed %d on the extra key and %d on position 12 with score %d, want them swapped", extra[0], layout[12], score)
+	}
+}
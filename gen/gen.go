@@ -1,6 +1,7 @@
 package gen
 
 import "sort"
+import "time"
 import "math/rand"
 
 import "../kbdlayout"
@@ -9,17 +10,39 @@ import "../kbdscoring"
 type LayoutEntry struct {
 	Layout kbdlayout.KeyboardLayout
 	Score  uint64
+
+	// the worker and its generation the layout is the best of,
+	// set only on the layouts sent by the workers
+	Worker     int
+	Generation uint64
+	// layouts scored by the worker so far
+	Evaluations uint64
+	// how different the parents of the generation are, from 0 to 1,
+	// set only by EvolvePopulation
+	Diversity float64
 }
 
-func EvolvePopulation(sf kbdscoring.ScoringFunction, generationBest chan<- *LayoutEntry, done <-chan struct{}) {
+// Evolves a population until done is closed, sending the best of each
+// generation to generationBest. The island connects the population to
+// the other populations for migration, it can be nil if there are none.
+func EvolvePopulation(sf kbdscoring.ScoringFunction, opts *Options, island *Island, generationBest chan<- *LayoutEntry, done <-chan struct{}) {
+
+	rng := opts.newRand(island)
+	stats := opts.Stats.worker(island)
+	var evaluations uint64
 
-	// random population of 1000 layouts
-	population := createRandomPopulation(1000)
+	// random population to start with
+	population := createRandomPopulation(rng, uint64(opts.PopulationSize))
+	for i := range population {
+		enforce(rng, &population[i].Layout, opts.Constraints)
+	}
 
-	var currentBest uint64
+	var generation uint64
 
-	const numberOfParents = 35
-	numberToRandomize := 100
+	numberOfParents := opts.Parents
+	crossover := Crossovers[opts.Crossover]
+	numberToRandomize := opts.RandomizeMin
+	mutationFactor := opts.MutationFactor
 
 	for {
 		select {
@@ -29,28 +52,62 @@ func EvolvePopulation(sf kbdscoring.ScoringFunction, generationBest chan<- *Layo
 		default:
 			// no signal yet, do another generation
 
-			// 1) sort the population so the best scores are on top
-			sortPopulation(population, sf)
+			generation++
+			start := time.Now()
 
-			// and send the best of the population to the main thread
-			generationBest <- &LayoutEntry{
-				Score:  population[0].Score,
-				Layout: population[0].Layout,
+			// 1) sort the population so the best scores are on top
+			scorePopulation(population, sf)
+			if len(opts.Constraints) > 0 {
+				rejectDisallowed(population, opts.Constraints)
 			}
-
-			// HACK: this will increase the randomness of the population
-			// when the population doesn't evolve
-			// TODO: figure out a better way to get past the local maximums
-			if population[0].Score > currentBest {
-				currentBest = population[0].Score
-				numberToRandomize = 100
-			} else {
-				numberToRandomize += 10
-				if numberToRandomize > 990 {
-					currentBest = 0
-					numberToRandomize = 100
-				}
+			evaluations += uint64(len(population))
+			start = stats.scored(start, len(population))
+			sort.Sort(ByScore(population))
+			start = stats.sorted(start)
+
+			// the parents make the next generation, when they are all
+			// alike the population has converged
+			diversity := populationDiversity(population[:numberOfParents])
+
+			// share the best with the neighbouring islands
+			island.emigrate(population, generation)
+			start = stats.bred(start)
+
+			// and send the best of the population to the main thread,
+			// unless it has already stopped listening
+			select {
+			case generationBest <- &LayoutEntry{
+				Score:      population[0].Score,
+				Layout:     population[0].Layout,
+				Worker:     island.ID(),
+				Generation: generation,
+
+				Evaluations: evaluations,
+				Diversity:   diversity,
+			}:
+			case <-done:
+				return
+			}
+			start = stats.sent(start)
+
+			// keep the population from converging to one local maximum:
+			// while the parents are too alike, bring in more random layouts
+			// and migrants and mutate more, and go back when they differ
+			var shortfall float64
+			if diversity < opts.MinDiversity {
+				shortfall = (opts.MinDiversity - diversity) / opts.MinDiversity
+			}
+			target := opts.RandomizeMin + int(shortfall*float64(opts.RandomizeMax-opts.RandomizeMin))
+			if target > numberToRandomize+opts.RandomizeStep {
+				target = numberToRandomize + opts.RandomizeStep
 			}
+			numberToRandomize = target
+			mutationFactor = opts.MutationFactor + int(shortfall*float64(opts.MutationFactor))
+			minSwaps := 0
+			if shortfall > 0 {
+				minSwaps = 1
+			}
+			stats.adapted(diversity, numberToRandomize, mutationFactor)
 
 			// 2) mix top n to have new generation
 			num := numberOfParents
@@ -60,7 +117,7 @@ func EvolvePopulation(sf kbdscoring.ScoringFunction, generationBest chan<- *Layo
 						if i == j {
 							continue
 						}
-						mix(&population[num].Layout, &population[i].Layout, &population[j].Layout)
+						crossover.Cross(rng, &population[num].Layout, &population[i].Layout, &population[j].Layout)
 						num++
 					}
 				}
@@ -68,32 +125,43 @@ func EvolvePopulation(sf kbdscoring.ScoringFunction, generationBest chan<- *Layo
 
 			// 3) mutate all
 			for i := 0; i < len(population)-numberToRandomize; i++ {
-				mutate(&population[i].Layout)
+				mutate(rng, &population[i].Layout, mutationFactor, minSwaps)
 			}
 
 			// 4) randomize the rest
 			for i := len(population) - numberToRandomize; i < len(population); i++ {
-				randomizeLayout(&population[i].Layout)
+				randomizeLayout(rng, &population[i].Layout)
+			}
+
+			// bring the new layouts back within the constraints
+			if len(opts.Constraints) > 0 {
+				for i := range population {
+					enforce(rng, &population[i].Layout, opts.Constraints)
+				}
 			}
 
+			// 5) let the migrants from other islands take the place
+			// of the randomized ones
+			island.immigrate(population[len(population)-numberToRandomize:])
+			stats.bred(start)
 		}
 	}
 }
 
-func createRandomPopulation(size uint64) []LayoutEntry {
+func createRandomPopulation(rng *rand.Rand, size uint64) []LayoutEntry {
 	population := make([]LayoutEntry, size)
 	for i := uint64(0); i < size; i++ {
 		population[i] = LayoutEntry{}
-		randomizeLayout(&population[i].Layout)
+		randomizeLayout(rng, &population[i].Layout)
 	}
 	return population
 }
 
-func randomizeLayout(layout *kbdlayout.KeyboardLayout) {
+func randomizeLayout(rng *rand.Rand, layout *kbdlayout.KeyboardLayout) {
 
 	freeCharIds := []uint8{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29}
 	for i := 0; i < 30; i++ {
-		idx := rand.Intn(len(freeCharIds))
+		idx := rng.Intn(len(freeCharIds))
 		charId := freeCharIds[idx]
 		freeCharIds[idx] = freeCharIds[len(freeCharIds)-1]
 		freeCharIds = freeCharIds[:len(freeCharIds)-1]
@@ -108,16 +176,18 @@ func (a ByScore) Len() int           { return len(a) }
 func (a ByScore) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
 func (a ByScore) Less(i, j int) bool { return a[i].Score > a[j].Score }
 
-func sortPopulation(population []LayoutEntry, sf kbdscoring.ScoringFunction) {
+func scorePopulation(population []LayoutEntry, sf kbdscoring.ScoringFunction) {
 	for i := 0; i < len(population); i++ {
 		population[i].Score = sf.CalculateScore(&population[i].Layout)
 	}
-	sort.Sort(ByScore(population))
 }
 
 // Mix two parents to get a child
-func mix(child, parent1, parent2 *kbdlayout.KeyboardLayout) {
-	// TODO: there should be easier way to mix two layouts
+//
+// Characters are taken from the same positions they have on the parents,
+// preferring one parent by a random ratio. When neither parent has a free
+// character for the remaining positions, random ones are used.
+func mix(rng *rand.Rand, child, parent1, parent2 *kbdlayout.KeyboardLayout) {
 	freePositions := []uint8{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29}
 	charactersUsed := []bool{false, false, false, false, false, false, false, false, false, false,
 		false, false, false, false, false, false, false, false, false, false,
@@ -125,7 +195,7 @@ func mix(child, parent1, parent2 *kbdlayout.KeyboardLayout) {
 
 	// mix ratio tells how much to take from parent1 vs parent2
 	// 20% to 80%
-	mixRatio := 0.2 + rand.Float64()*0.6
+	mixRatio := 0.2 + rng.Float64()*0.6
 
 	// setup array for the parents for easier indexing
 	parents := [2]*kbdlayout.KeyboardLayout{parent1, parent2}
@@ -137,7 +207,7 @@ func mix(child, parent1, parent2 *kbdlayout.KeyboardLayout) {
 
 		// default to parent2
 		p := 1
-		if rand.Float64() < mixRatio {
+		if rng.Float64() < mixRatio {
 			// use parent1
 			p = 0
 		}
@@ -171,17 +241,23 @@ func mix(child, parent1, parent2 *kbdlayout.KeyboardLayout) {
 		}
 
 		// could not find suitable free location with free character on p
-		// in this case we just pick a random free location with a free
-		freePosId := rand.Intn(len(freePositions))
+		// in this case we just pick a random free location with a random free character
+		freePosId := rng.Intn(len(freePositions))
 		freePos := freePositions[freePosId]
 		freePositions[freePosId] = freePositions[len(freePositions)-1]
 		freePositions = freePositions[:len(freePositions)-1]
+
+		// there are as many free characters as there were free positions
+		nth := rng.Intn(len(freePositions) + 1)
 		charId := uint8(0)
 		for j := uint8(0); j < 30; j++ {
 			if !charactersUsed[j] {
-				charactersUsed[j] = true
-				charId = j
-				break
+				if nth == 0 {
+					charactersUsed[j] = true
+					charId = j
+					break
+				}
+				nth--
 			}
 		}
 		child[freePos] = charId
@@ -189,12 +265,14 @@ func mix(child, parent1, parent2 *kbdlayout.KeyboardLayout) {
 }
 
 // Mutate the layout a bit with random
-func mutate(layout *kbdlayout.KeyboardLayout) {
-	// TODO: some better magic numbers needed here
-	numMutations := rand.Intn(7) * rand.Intn(7)
+func mutate(rng *rand.Rand, layout *kbdlayout.KeyboardLayout, factor int, minSwaps int) {
+	numMutations := rng.Intn(factor) * rng.Intn(factor)
+	if numMutations < minSwaps {
+		numMutations = minSwaps
+	}
 	for i := 0; i < numMutations; i++ {
-		p1 := rand.Intn(30)
-		p2 := rand.Intn(30)
+		p1 := rng.Intn(30)
+		p2 := rng.Intn(30)
 		r := layout[p1]
 		layout[p1] = layout[p2]
 		layout[p2] = r
@@ -0,0 +1,65 @@
+package gen
+
+import "sort"
+
+import "../kbdlayout"
+
+// HallOfFame keeps the best distinct layouts seen. Layouts are distinct
+// when it takes at least the minimum distance of swaps to turn one into
+// another, so near copies of a better layout are left out.
+type HallOfFame struct {
+	size        int
+	minDistance int
+	entries     []LayoutEntry // best first
+}
+
+// Creates a hall of fame for size layouts. Minimum distance less than
+// one only leaves out the exact copies.
+func NewHallOfFame(size, minDistance int) *HallOfFame {
+	if minDistance < 1 {
+		minDistance = 1
+	}
+	return &HallOfFame{
+		size:        size,
+		minDistance: minDistance,
+	}
+}
+
+// Adds a copy of the entry if it is good enough and distinct enough.
+// Entries that are too close to it but worse are removed. Returns
+// true if the entry was added.
+func (h *HallOfFame) Add(entry *LayoutEntry) bool {
+	if h.size <= 0 {
+		return false
+	}
+	if len(h.entries) == h.size && entry.Score <= h.entries[len(h.entries)-1].Score {
+		// not better than any we already have
+		return false
+	}
+
+	// keep the entries that are distinct from the new one
+	kept := make([]LayoutEntry, 0, len(h.entries)+1)
+	for i := range h.entries {
+		if kbdlayout.SwapDistance(&h.entries[i].Layout, &entry.Layout) >= h.minDistance {
+			kept = append(kept, h.entries[i])
+			continue
+		}
+		if h.entries[i].Score >= entry.Score {
+			// there is already a better one like this
+			return false
+		}
+	}
+
+	kept = append(kept, *entry)
+	sort.Stable(ByScore(kept))
+	if len(kept) > h.size {
+		kept = kept[:h.size]
+	}
+	h.entries = kept
+	return true
+}
+
+// Returns the layouts in the hall of fame, best first
+func (h *HallOfFame) Entries() []LayoutEntry {
+	return h.entries
+}
@@ -0,0 +1,192 @@
+package gen
+
+import "fmt"
+import "strings"
+import "sync/atomic"
+
+// Topology tells which islands send their migrants to which.
+type Topology int
+
+const (
+	// islands never exchange individuals
+	Isolated Topology = iota
+	// every island sends migrants to the next one, the last one to the first
+	Ring
+	// every island sends migrants to all of the other islands
+	FullyConnected
+)
+
+var topologyNames = map[string]Topology{
+	"none": Isolated,
+	"ring": Ring,
+	"full": FullyConnected,
+}
+
+// Parses topology from its name (none/ring/full)
+func ParseTopology(name string) (Topology, error) {
+	topology, ok := topologyNames[strings.ToLower(name)]
+	if !ok {
+		return Isolated, fmt.Errorf("unknown topology '%s'", name)
+	}
+	return topology, nil
+}
+
+func (t Topology) String() string {
+	for name, topology := range topologyNames {
+		if topology == t {
+			return name
+		}
+	}
+	return fmt.Sprintf("Topology(%d)", int(t))
+}
+
+// Island connects the population of one EvolvePopulation goroutine
+// to its neighbours. Every interval generations the best migrants
+// individuals are copied to the neighbours, where they replace the
+// randomized part of the population.
+type Island struct {
+	id         int // index of the island, also identifies the worker
+	inbox      chan []LayoutEntry
+	neighbours []chan<- []LayoutEntry
+	interval   uint64 // generations between migrations
+	migrants   int    // number of individuals sent on each migration
+	// best score of all the islands created together, updated with atomics
+	best *uint64
+}
+
+// Creates count islands connected with the given topology
+func NewIslands(count int, topology Topology, interval uint64, migrants int) []*Island {
+	islands := make([]*Island, count)
+	best := new(uint64)
+	for i := 0; i < count; i++ {
+		islands[i] = &Island{
+			best: best,
+			id:   i,
+			// every neighbour can have one migration pending, so nobody
+			// needs to wait for the receiver in a normal case
+			inbox:    make(chan []LayoutEntry, count),
+			interval: interval,
+			migrants: migrants,
+		}
+	}
+
+	for i := 0; i < count; i++ {
+		switch topology {
+		case Ring:
+			if count > 1 {
+				islands[i].neighbours = append(islands[i].neighbours, islands[(i+1)%count].inbox)
+			}
+		case FullyConnected:
+			for j := 0; j < count; j++ {
+				if i != j {
+					islands[i].neighbours = append(islands[i].neighbours, islands[j].inbox)
+				}
+			}
+		}
+	}
+
+	return islands
+}
+
+// Returns the index of the island among the islands created
+// together, 0 if there is no island
+func (island *Island) ID() int {
+	if island == nil {
+		return 0
+	}
+	return island.id
+}
+
+// Sends copies of the top of the sorted population to the neighbours
+func (island *Island) emigrate(population []LayoutEntry, generation uint64) {
+	if island == nil || island.interval == 0 || generation%island.interval != 0 {
+		return
+	}
+
+	count := island.migrants
+	if count > len(population) {
+		count = len(population)
+	}
+
+	for _, neighbour := range island.neighbours {
+		// every neighbour gets its own copy, as the receiver will modify it
+		migrants := make([]LayoutEntry, count)
+		copy(migrants, population[:count])
+
+		select {
+		case neighbour <- migrants:
+		default:
+			// the neighbour has not yet taken in our previous migrants,
+			// we won't wait for it but skip this migration
+		}
+	}
+}
+
+// Replaces the end of the given part of the population with the
+// migrants that have arrived. Individuals in the part should be the
+// expendable ones, as they will be overwritten.
+func (island *Island) immigrate(expendable []LayoutEntry) {
+	if island == nil {
+		return
+	}
+
+	pos := len(expendable)
+	for {
+		select {
+		case migrants := <-island.inbox:
+			// migrants are sorted best first, so if there are more
+			// of them than room, the worst ones are left out
+			for i := 0; i < len(migrants) && pos > 0; i++ {
+				pos--
+				expendable[pos] = migrants[i]
+			}
+		default:
+			// no more migrants waiting
+			return
+		}
+	}
+}
+
+// Takes in the migrants that have arrived, like immigrate, and returns
+// the best of them, for workers that only keep one layout. Returns false
+// if none have arrived.
+func (island *Island) bestImmigrant() (LayoutEntry, bool) {
+	var best LayoutEntry
+	found := false
+	if island == nil {
+		return best, found
+	}
+	for {
+		select {
+		case migrants := <-island.inbox:
+			// migrants are sorted best first
+			if len(migrants) > 0 && (!found || migrants[0].Score > best.Score) {
+				best = migrants[0]
+				found = true
+			}
+		default:
+			return best, found
+		}
+	}
+}
+
+// Records the score as the best of all the islands if it is better
+func (island *Island) offerBest(score uint64) {
+	if island == nil {
+		return
+	}
+	for {
+		best := atomic.LoadUint64(island.best)
+		if score <= best || atomic.CompareAndSwapUint64(island.best, best, score) {
+			return
+		}
+	}
+}
+
+// Returns the best score offered by any of the islands, 0 if there is no island
+func (island *Island) bestScore() uint64 {
+	if island == nil {
+		return 0
+	}
+	return atomic.LoadUint64(island.best)
+}
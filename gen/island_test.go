@@ -0,0 +1,35 @@
+package gen
+
+import "testing"
+
+func TestBestImmigrantIsTheBestOfAllArrivals(t *testing.T) {
+	islands := NewIslands(3, FullyConnected, 1, 2)
+	if _, ok := islands[2].bestImmigrant(); ok {
+		t.Fatal("migrant arrived before any was sent")
+	}
+
+	islands[0].emigrate([]LayoutEntry{{Score: 5}, {Score: 3}}, 1)
+	islands[1].emigrate([]LayoutEntry{{Score: 9}, {Score: 7}}, 1)
+	best, ok := islands[2].bestImmigrant()
+	if !ok || best.Score != 9 {
+		t.Errorf("best migrant has score %d (arrived %v), want 9", best.Score, ok)
+	}
+	if _, ok := islands[2].bestImmigrant(); ok {
+		t.Error("migrants left in the inbox after taking the best")
+	}
+}
+
+func TestBestScoreIsSharedByTheIslands(t *testing.T) {
+	islands := NewIslands(2, Isolated, 0, 0)
+	islands[0].offerBest(10)
+	islands[1].offerBest(4)
+	for _, island := range islands {
+		if score := island.bestScore(); score != 10 {
+			t.Errorf("island %d has best score %d, want 10", island.ID(), score)
+		}
+	}
+	// the other islands of a later run don't see it
+	if score := NewIslands(1, Isolated, 0, 0)[0].bestScore(); score != 0 {
+		t.Errorf("new island has best score %d, want 0", score)
+	}
+}
@@ -0,0 +1,373 @@
+package gen
+
+import "sort"
+
+import "../kbdlayout"
+import "../kbdscoring"
+
+// Finds the best arrangement of the characters on the given positions
+// of the layout, leaving the other positions as they are, and changes
+// the layout in place to it.
+//
+// The search goes through all the permutations, so the result is the
+// optimum for the positions. With a kbdscoring.PairwiseScoringFunction
+// the branches that can't beat the best arrangement found so far are
+// pruned: the score of the keys placed so far is known exactly, and the
+// keys still to place can at most add the best scores they could get.
+// Other scoring functions are scored on every arrangement, which is
+// feasible only for a few positions.
+//
+// Arrangements that break any of the constraints are skipped. The layout
+// is left as it is if no arrangement is better.
+//
+// The search can take long, progress, if not nil, is called every
+// OptimizeProgressInterval arrangements looked at with their number and
+// the best score so far.
+//
+// Returns the score of the layout and the number of arrangements,
+// partial or complete, that were looked at.
+func Optimize(sf kbdscoring.ScoringFunction, layout *kbdlayout.KeyboardLayout, positions []int, progress func(visited, bestScore uint64), constraints ...Constraint) (uint64, uint64) {
+	o := &optimizer{
+		sf:          sf,
+		layout:      *layout,
+		positions:   positions,
+		progress:    progress,
+		constraints: constraints,
+		used:        make([]bool, len(positions)),
+		assigned:    make([]int, len(positions)),
+	}
+	for _, pos := range positions {
+		o.chars = append(o.chars, layout[pos])
+	}
+
+	o.best = *layout
+	if allowed(layout, constraints) {
+		o.bestScore = sf.CalculateScore(layout)
+	}
+
+	if pairwise, ok := sf.(kbdscoring.PairwiseScoringFunction); ok {
+		o.pairwise = pairwise
+		o.prepareBounds()
+		// a good arrangement to begin with prunes more
+		o.climb()
+	}
+	o.search(0, 0)
+
+	*layout = o.best
+	return sf.CalculateScore(layout), o.visited
+}
+
+// arrangements looked at between the calls to the progress of Optimize
+const OptimizeProgressInterval = 1 << 16
+
+type optimizer struct {
+	sf          kbdscoring.ScoringFunction
+	pairwise    kbdscoring.PairwiseScoringFunction // nil if the score can't be split
+	layout      kbdlayout.KeyboardLayout           // being arranged
+	positions   []int
+	chars       []uint8 // the characters to arrange on the positions
+	constraints []Constraint
+	progress    func(visited, bestScore uint64)
+
+	// score of the positions not arranged, and the scores of the
+	// characters on the positions: keyScores[i][a] of chars[a] on
+	// positions[i] with the positions not arranged, pairScores[i][j][a][b]
+	// of chars[a] on positions[i] with chars[b] on positions[j]
+	fixedScore uint64
+	keyScores  [][]uint64
+	pairScores [][][][]uint64
+	// characters to try on each position, most promising first
+	order [][]int
+
+	used     []bool // by character index
+	assigned []int  // character index by position index, for the first positions
+
+	best      kbdlayout.KeyboardLayout
+	bestScore uint64
+	visited   uint64
+}
+
+func (o *optimizer) prepareBounds() {
+	arranged := [30]bool{}
+	for _, pos := range o.positions {
+		arranged[pos] = true
+	}
+
+	for i := 0; i < 30; i++ {
+		if arranged[i] {
+			continue
+		}
+		o.fixedScore += o.pairwise.KeyScore(i, o.layout[i])
+		for j := i + 1; j < 30; j++ {
+			if !arranged[j] {
+				o.fixedScore += o.pairwise.PairScore(i, o.layout[i], j, o.layout[j])
+			}
+		}
+	}
+
+	keyScore := func(pos int, char uint8) uint64 {
+		score := o.pairwise.KeyScore(pos, char)
+		for other := 0; other < 30; other++ {
+			if !arranged[other] {
+				score += o.pairwise.PairScore(pos, char, other, o.layout[other])
+			}
+		}
+		return score
+	}
+
+	// place first the positions where the choice matters the most,
+	// so the bounds get tight early
+	spread := map[int]uint64{}
+	for _, pos := range o.positions {
+		var min, max uint64 = ^uint64(0), 0
+		for _, char := range o.chars {
+			score := keyScore(pos, char)
+			if score < min {
+				min = score
+			}
+			if score > max {
+				max = score
+			}
+		}
+		spread[pos] = max - min
+	}
+	o.positions = append([]int(nil), o.positions...)
+	sort.SliceStable(o.positions, func(i, j int) bool {
+		return spread[o.positions[i]] > spread[o.positions[j]]
+	})
+
+	n := len(o.positions)
+	o.keyScores = make([][]uint64, n)
+	o.order = make([][]int, n)
+	for i, pos := range o.positions {
+		o.keyScores[i] = make([]uint64, n)
+		for a, char := range o.chars {
+			o.keyScores[i][a] = keyScore(pos, char)
+		}
+
+		o.order[i] = make([]int, n)
+		for a := range o.order[i] {
+			o.order[i][a] = a
+		}
+		scores := o.keyScores[i]
+		sort.Slice(o.order[i], func(a, b int) bool {
+			return scores[o.order[i][a]] > scores[o.order[i][b]]
+		})
+	}
+
+	o.pairScores = make([][][][]uint64, n)
+	for i := range o.positions {
+		o.pairScores[i] = make([][][]uint64, n)
+		for j := range o.positions {
+			if i == j {
+				continue
+			}
+			o.pairScores[i][j] = make([][]uint64, n)
+			for a := range o.chars {
+				o.pairScores[i][j][a] = make([]uint64, n)
+				for b := range o.chars {
+					if a == b {
+						continue
+					}
+					o.pairScores[i][j][a][b] = o.pairwise.PairScore(o.positions[i], o.chars[a], o.positions[j], o.chars[b])
+				}
+			}
+		}
+	}
+}
+
+// Places the characters on the positions from depth on, the score of
+// the characters placed before is partial
+func (o *optimizer) search(depth int, partial uint64) {
+	o.visited++
+	if o.progress != nil && o.visited%OptimizeProgressInterval == 0 {
+		o.progress(o.visited, o.bestScore)
+	}
+
+	if depth == len(o.positions) {
+		score := partial + o.fixedScore
+		if o.pairwise == nil {
+			score = o.sf.CalculateScore(&o.layout)
+		}
+		if score > o.bestScore && allowed(&o.layout, o.constraints) {
+			o.best = o.layout
+			o.bestScore = score
+		}
+		return
+	}
+
+	if o.pairwise != nil && partial+o.fixedScore+o.bound(depth) <= o.bestScore {
+		// nothing below can beat the best
+		return
+	}
+
+	for a := range o.chars {
+		if o.pairwise != nil {
+			a = o.order[depth][a]
+		}
+		if o.used[a] {
+			continue
+		}
+
+		var gain uint64
+		if o.pairwise != nil {
+			gain = o.gain(depth, a, depth)
+		}
+
+		o.used[a] = true
+		o.assigned[depth] = a
+		o.layout[o.positions[depth]] = o.chars[a]
+		o.search(depth+1, partial+gain)
+		o.used[a] = false
+	}
+}
+
+// Returns the score added by placing the character a on the
+// position i, with the characters on the placed first positions
+func (o *optimizer) gain(i int, a int, placed int) uint64 {
+	gain := o.keyScores[i][a]
+	for j := 0; j < placed; j++ {
+		gain += o.pairScores[i][j][a][o.assigned[j]]
+	}
+	return gain
+}
+
+// Returns an upper bound for the score the positions from depth on can
+// add (the Gilmore-Lawler bound). Each free character on each free
+// position is given its score with the placed characters, and half of
+// its best pair score with a free character on every other free position.
+// The best assignment of the characters to the positions by these
+// scores can't be beaten by any actual arrangement.
+func (o *optimizer) bound(depth int) uint64 {
+	var free []int
+	for a := range o.chars {
+		if !o.used[a] {
+			free = append(free, a)
+		}
+	}
+
+	n := len(free)
+	scores := make([][]uint64, n)
+	for i := 0; i < n; i++ {
+		scores[i] = make([]uint64, n)
+		pos := depth + i
+		for x, a := range free {
+			score := 2 * o.gain(pos, a, depth)
+			for other := depth; other < len(o.positions); other++ {
+				if other == pos {
+					continue
+				}
+				var best uint64
+				for _, b := range free {
+					if b != a && o.pairScores[pos][other][a][b] > best {
+						best = o.pairScores[pos][other][a][b]
+					}
+				}
+				score += best
+			}
+			scores[i][x] = score
+		}
+	}
+
+	// the scores are doubled to keep the halves whole, round up
+	return (maxAssignment(scores) + 1) / 2
+}
+
+// Returns the highest total score of assigning each row to a different
+// column, with the Hungarian algorithm
+func maxAssignment(scores [][]uint64) uint64 {
+	n := len(scores)
+	if n == 0 {
+		return 0
+	}
+
+	// minimize the costs of max-score, with potentials u and v
+	var max uint64
+	for _, row := range scores {
+		for _, score := range row {
+			if score > max {
+				max = score
+			}
+		}
+	}
+	cost := func(i, j int) int64 { return int64(max - scores[i-1][j-1]) }
+
+	const inf = int64(^uint64(0) >> 1)
+	u := make([]int64, n+1)
+	v := make([]int64, n+1)
+	match := make([]int, n+1) // row matched to each column, 0 if none
+	way := make([]int, n+1)
+	for i := 1; i <= n; i++ {
+		match[0] = i
+		j0 := 0
+		minv := make([]int64, n+1)
+		used := make([]bool, n+1)
+		for j := range minv {
+			minv[j] = inf
+		}
+		for {
+			used[j0] = true
+			i0 := match[j0]
+			delta := inf
+			j1 := 0
+			for j := 1; j <= n; j++ {
+				if used[j] {
+					continue
+				}
+				if c := cost(i0, j) - u[i0] - v[j]; c < minv[j] {
+					minv[j] = c
+					way[j] = j0
+				}
+				if minv[j] < delta {
+					delta = minv[j]
+					j1 = j
+				}
+			}
+			for j := 0; j <= n; j++ {
+				if used[j] {
+					u[match[j]] += delta
+					v[j] -= delta
+				} else {
+					minv[j] -= delta
+				}
+			}
+			j0 = j1
+			if match[j0] == 0 {
+				break
+			}
+		}
+		for j0 != 0 {
+			j1 := way[j0]
+			match[j0] = match[j1]
+			j0 = j1
+		}
+	}
+
+	var total uint64
+	for j := 1; j <= n; j++ {
+		total += scores[match[j]-1][j-1]
+	}
+	return total
+}
+
+// Improves the best arrangement with swaps among the positions,
+// until no swap improves it
+func (o *optimizer) climb() {
+	layout := o.best
+	for improved := true; improved; {
+		improved = false
+		for i := range o.positions {
+			for j := i + 1; j < len(o.positions); j++ {
+				a, b := o.positions[i], o.positions[j]
+				layout[a], layout[b] = layout[b], layout[a]
+				if score := o.sf.CalculateScore(&layout); score > o.bestScore && allowed(&layout, o.constraints) {
+					o.best = layout
+					o.bestScore = score
+					improved = true
+				} else {
+					layout[a], layout[b] = layout[b], layout[a]
+				}
+			}
+		}
+	}
+}
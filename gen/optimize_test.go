@@ -0,0 +1,169 @@
+package gen
+
+import "testing"
+import "math/rand"
+
+import "../kbdlayout"
+import "../kbdscoring"
+
+// Pairwise scoring with random scores of the characters on the
+// positions and random, symmetric scores of the pairs
+type randomPairwise struct {
+	keys   [30][30]uint64 // by position and character
+	values [30][30]uint64 // the pair score is a product of these
+}
+
+func newRandomPairwise(rng *rand.Rand) *randomPairwise {
+	sf := &randomPairwise{}
+	for pos := 0; pos < 30; pos++ {
+		for charId := 0; charId < 30; charId++ {
+			sf.keys[pos][charId] = uint64(rng.Intn(1000))
+			sf.values[pos][charId] = uint64(rng.Intn(100))
+		}
+	}
+	return sf
+}
+
+func (sf *randomPairwise) Init(mapping *kbdlayout.KeyboardMapping) {}
+
+func (sf *randomPairwise) KeyScore(pos int, charId uint8) uint64 {
+	return sf.keys[pos][charId]
+}
+
+func (sf *randomPairwise) PairScore(pos1 int, charId1 uint8, pos2 int, charId2 uint8) uint64 {
+	return sf.values[pos1][charId1] * sf.values[pos2][charId2] % 997
+}
+
+func (sf *randomPairwise) CalculateScore(layout *kbdlayout.KeyboardLayout) uint64 {
+	var score uint64
+	for i := 0; i < 30; i++ {
+		score += sf.KeyScore(i, layout[i])
+		for j := i + 1; j < 30; j++ {
+			score += sf.PairScore(i, layout[i], j, layout[j])
+		}
+	}
+	return score
+}
+
+func (sf *randomPairwise) NormalizeScore(score uint64) float64 {
+	return float64(score)
+}
+
+// Hides the pairwise scores, so that Optimize can't prune
+type opaqueScore struct {
+	sf kbdscoring.ScoringFunction
+}
+
+func (o opaqueScore) Init(mapping *kbdlayout.KeyboardMapping) {}
+
+func (o opaqueScore) CalculateScore(layout *kbdlayout.KeyboardLayout) uint64 {
+	return o.sf.CalculateScore(layout)
+}
+
+func (o opaqueScore) NormalizeScore(score uint64) float64 {
+	return float64(score)
+}
+
+// Returns the best score of all the arrangements of the positions that
+// the constraints allow, and whether any of them does
+func bruteForce(sf kbdscoring.ScoringFunction, layout kbdlayout.KeyboardLayout, positions []int, constraints []Constraint) (uint64, bool) {
+	var best uint64
+	found := false
+	var arrange func(k int)
+	arrange = func(k int) {
+		if k == len(positions) {
+			if allowed(&layout, constraints) {
+				if score := sf.CalculateScore(&layout); !found || score > best {
+					best, found = score, true
+				}
+			}
+			return
+		}
+		for i := k; i < len(positions); i++ {
+			a, b := positions[k], positions[i]
+			layout[a], layout[b] = layout[b], layout[a]
+			arrange(k + 1)
+			layout[a], layout[b] = layout[b], layout[a]
+		}
+	}
+	arrange(0)
+	return best, found
+}
+
+func TestOptimizeMatchesBruteForce(t *testing.T) {
+	for seed := int64(0); seed < 200; seed++ {
+		rng := rand.New(rand.NewSource(seed))
+		pairwise := newRandomPairwise(rng)
+
+		var original kbdlayout.KeyboardLayout
+		randomizeLayout(rng, &original)
+		positions := rng.Perm(30)[:2+rng.Intn(6)]
+
+		var constraints []Constraint
+		kind := "unconstrained"
+		if seed%2 == 1 {
+			// the reference is another layout, so the original may break it
+			reference := original
+			for _, pos := range positions[:1+rng.Intn(len(positions)-1)] {
+				other := positions[rng.Intn(len(positions))]
+				reference[pos], reference[other] = reference[other], reference[pos]
+			}
+			constraints = append(constraints, &MaxMovedKeys{Reference: reference, Max: rng.Intn(len(positions))})
+			kind = "constrained"
+		}
+
+		for _, sf := range []kbdscoring.ScoringFunction{pairwise, opaqueScore{pairwise}} {
+			want, found := bruteForce(sf, original, positions, constraints)
+
+			layout := original
+			score, _ := Optimize(sf, &layout, positions, nil, constraints...)
+			if score != sf.CalculateScore(&layout) {
+				t.Fatalf("seed %d, %s %T: returned score %d, the layout scores %d", seed, kind, sf, score, sf.CalculateScore(&layout))
+			}
+			if !found {
+				if layout != original {
+					t.Fatalf("seed %d, %s %T: changed the layout with no arrangement allowed", seed, kind, sf)
+				}
+				continue
+			}
+			if score != want || !allowed(&layout, constraints) {
+				t.Fatalf("seed %d, %s %T, positions %v: score %d (allowed %v), brute force %d",
+					seed, kind, sf, positions, score, allowed(&layout, constraints), want)
+			}
+			for pos := range layout {
+				if layout[pos] != original[pos] && !contains(positions, pos) {
+					t.Fatalf("seed %d, %s %T: moved position %d not among %v", seed, kind, sf, pos, positions)
+				}
+			}
+		}
+	}
+}
+
+func contains(positions []int, pos int) bool {
+	for _, p := range positions {
+		if p == pos {
+			return true
+		}
+	}
+	return false
+}
+
+func TestOptimizeReportsProgress(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	sf := opaqueScore{newRandomPairwise(rng)}
+	var layout kbdlayout.KeyboardLayout
+	randomizeLayout(rng, &layout)
+
+	var calls uint64
+	var last uint64
+	_, visited := Optimize(sf, &layout, []int{0, 1, 2, 3, 4, 5, 6, 7}, func(visited, bestScore uint64) {
+		calls++
+		if visited <= last {
+			t.Errorf("progress went from %d to %d arrangements", last, visited)
+		}
+		last = visited
+	})
+	if want := visited / OptimizeProgressInterval; calls != want {
+		t.Errorf("progress called %d times for %d arrangements, want %d", calls, visited, want)
+	}
+}
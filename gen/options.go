@@ -0,0 +1,183 @@
+package gen
+
+import "os"
+import "fmt"
+import "time"
+import "math/rand"
+import "encoding/json"
+
+// Options for the genetic algorithm. The zero value is not usable,
+// start from DefaultOptions and override what is needed.
+type Options struct {
+	// number of layouts in each population
+	PopulationSize int `json:"population-size"`
+	// number of best layouts in a generation that are mixed
+	// with each other to create the next generation
+	Parents int `json:"parents"`
+
+	// number of layouts replaced with random ones or migrants on each
+	// generation. While the diversity of the parents is below MinDiversity,
+	// the number grows by RandomizeStep up to RandomizeMax, and shrinks
+	// back towards RandomizeMin when it is above
+	RandomizeMin  int `json:"randomize-min"`
+	RandomizeStep int `json:"randomize-step"`
+	RandomizeMax  int `json:"randomize-max"`
+
+	// diversity of the parents, from 0 when they are the same to 1
+	// when they have nothing in common, below which the population is
+	// considered converged
+	MinDiversity float64 `json:"min-diversity"`
+
+	// name of the Crossover used to mix the parents, see Crossovers
+	Crossover string `json:"crossover"`
+
+	// each layout gets rand.Intn(MutationFactor)*rand.Intn(MutationFactor)
+	// random swaps on each generation. The factor grows up to double
+	// while the population is converged, like the randomized layouts
+	MutationFactor int `json:"mutation-factor"`
+
+	// number of populations evolving in parallel and
+	// the number of threads to run them on
+	Workers  int `json:"workers"`
+	MaxProcs int `json:"max-procs"`
+
+	// restrictions for the generated layouts, these
+	// can't be given in the options file
+	Constraints []Constraint `json:"-"`
+
+	// migration between the populations, see Island
+	Topology          string `json:"topology"`
+	MigrationInterval uint64 `json:"migration-interval"`
+	Migrants          int    `json:"migrants"`
+
+	// name of the Worker searching the layouts, see Optimizers.
+	// The population options are for the genetic algorithm only.
+	Optimizer string `json:"optimizer"`
+
+	// generations a swap stays tabu and generations without improvement
+	// before starting over in TabuSearch, 0 for never
+	TabuTenure  int    `json:"tabu-tenure"`
+	TabuRestart uint64 `json:"tabu-restart"`
+
+	// seed of the random numbers of the workers, each worker gets its
+	// own sequence from it. 0 seeds from the time, so that each run differs.
+	// Only a single worker repeats its run exactly, as the migrants between
+	// workers arrive in whatever order the workers happen to run
+	Seed int64 `json:"seed"`
+
+	// where the workers record how they spend their time, nil for
+	// nowhere. Create with NewStats for the number of workers
+	Stats *Stats `json:"-"`
+}
+
+// Returns the options the generator has been tuned with
+func DefaultOptions() Options {
+	return Options{
+		PopulationSize:    1000,
+		Parents:           35,
+		RandomizeMin:      100,
+		RandomizeStep:     10,
+		RandomizeMax:      990,
+		MinDiversity:      0.2,
+		Crossover:         "mix",
+		MutationFactor:    7,
+		Workers:           10,
+		MaxProcs:          8,
+		Topology:          "ring",
+		MigrationInterval: 50,
+		Migrants:          5,
+		Optimizer:         "genetic",
+		TabuTenure:        15,
+		TabuRestart:       500,
+	}
+}
+
+// Reads options from a JSON file. Only the options present
+// in the file are changed.
+func (o *Options) Load(filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	decoder := json.NewDecoder(file)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(o); err != nil {
+		return fmt.Errorf("%s: %v", filename, err)
+	}
+	return nil
+}
+
+// Checks that the options can be used together
+func (o *Options) Validate() error {
+	if o.PopulationSize < 2 {
+		return fmt.Errorf("population size must be at least 2, got %d", o.PopulationSize)
+	}
+	if o.Parents < 2 || o.Parents > o.PopulationSize {
+		return fmt.Errorf("parents must be between 2 and population size %d, got %d", o.PopulationSize, o.Parents)
+	}
+	if o.RandomizeMin < 0 || o.RandomizeStep < 0 {
+		return fmt.Errorf("randomize min and step can't be negative")
+	}
+	if o.RandomizeMin > o.RandomizeMax {
+		return fmt.Errorf("randomize min %d is greater than randomize max %d", o.RandomizeMin, o.RandomizeMax)
+	}
+	if o.RandomizeMax >= o.PopulationSize {
+		return fmt.Errorf("randomize max %d must be less than population size %d", o.RandomizeMax, o.PopulationSize)
+	}
+	if o.MinDiversity < 0 || o.MinDiversity > 1 {
+		return fmt.Errorf("min diversity must be between 0 and 1, got %g", o.MinDiversity)
+	}
+	// every child should have a different pair of parents,
+	// otherwise the same pairs are mixed over and over again
+	children := o.PopulationSize - o.Parents - o.RandomizeMin
+	if o.Parents*(o.Parents-1) < children {
+		return fmt.Errorf("%d parents can only have %d different pairs, but %d children are needed (population size - parents - randomize min)",
+			o.Parents, o.Parents*(o.Parents-1), children)
+	}
+	if _, err := LookupCrossover(o.Crossover); err != nil {
+		return err
+	}
+	if o.MutationFactor < 1 {
+		return fmt.Errorf("mutation factor must be at least 1, got %d", o.MutationFactor)
+	}
+	if o.Workers < 1 {
+		return fmt.Errorf("there must be at least one worker, got %d", o.Workers)
+	}
+	if o.MaxProcs < 1 {
+		return fmt.Errorf("max procs must be at least 1, got %d", o.MaxProcs)
+	}
+	if _, err := ParseTopology(o.Topology); err != nil {
+		return err
+	}
+	if o.Migrants < 0 || o.Migrants > o.PopulationSize {
+		return fmt.Errorf("migrants must be between 0 and population size %d, got %d", o.PopulationSize, o.Migrants)
+	}
+	if _, err := LookupOptimizer(o.Optimizer); err != nil {
+		return err
+	}
+	// with 435 swaps, a longer tenure would leave nothing to swap
+	if o.TabuTenure < 0 || o.TabuTenure >= 435 {
+		return fmt.Errorf("tabu tenure must be between 0 and 434, got %d", o.TabuTenure)
+	}
+	return nil
+}
+
+// Creates the islands for the workers as defined by the options
+func (o *Options) NewIslands() []*Island {
+	// topology has been checked in Validate
+	topology, _ := ParseTopology(o.Topology)
+	return NewIslands(o.Workers, topology, o.MigrationInterval, o.Migrants)
+}
+
+// Returns the random numbers for the worker of the island, which
+// can be nil for a single worker
+func (o *Options) newRand(island *Island) *rand.Rand {
+	seed := o.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	// far apart seeds for the workers, so their sequences differ
+	return rand.New(rand.NewSource(seed + int64(island.ID())*7919))
+}
@@ -0,0 +1,82 @@
+package gen
+
+import "../kbdlayout"
+import "../kbdscoring"
+
+// Improves the layout in place with steepest-ascent hill climbing.
+//
+// On each round all 435 swaps of two keys are scored and the best one
+// is made, until none of them improves the score anymore. With cycles,
+// rotations of three keys are tried too when no swap helps, which gets
+// past some of the layouts that no single swap can improve.
+//
+// Moves that would break any of the constraints are not made.
+//
+// Returns the score of the polished layout.
+func Polish(sf kbdscoring.ScoringFunction, layout *kbdlayout.KeyboardLayout, cycles bool, constraints ...Constraint) uint64 {
+	score := sf.CalculateScore(layout)
+	for {
+		improved, newScore := bestSwap(sf, layout, score, constraints)
+		if !improved && cycles {
+			improved, newScore = bestRotation(sf, layout, score, constraints)
+		}
+		if !improved {
+			return score
+		}
+		score = newScore
+	}
+}
+
+// Makes the swap that improves the score the most, if any
+func bestSwap(sf kbdscoring.ScoringFunction, layout *kbdlayout.KeyboardLayout, score uint64, constraints []Constraint) (bool, uint64) {
+	bestI, bestJ := -1, -1
+	bestScore := score
+	for i := 0; i < 30; i++ {
+		for j := i + 1; j < 30; j++ {
+			layout[i], layout[j] = layout[j], layout[i]
+			if s := sf.CalculateScore(layout); s > bestScore && allowed(layout, constraints) {
+				bestI, bestJ, bestScore = i, j, s
+			}
+			layout[i], layout[j] = layout[j], layout[i]
+		}
+	}
+	if bestI < 0 {
+		return false, score
+	}
+	layout[bestI], layout[bestJ] = layout[bestJ], layout[bestI]
+	return true, bestScore
+}
+
+// Makes the rotation of three keys that improves the score the most, if any
+func bestRotation(sf kbdscoring.ScoringFunction, layout *kbdlayout.KeyboardLayout, score uint64, constraints []Constraint) (bool, uint64) {
+	var best [3]int
+	found := false
+	bestScore := score
+	for i := 0; i < 30; i++ {
+		for j := i + 1; j < 30; j++ {
+			for k := j + 1; k < 30; k++ {
+				// both directions of the rotation, the other
+				// one is the same as rotating j, i, k
+				for _, r := range [2][3]int{{i, j, k}, {j, i, k}} {
+					rotate(layout, r)
+					if s := sf.CalculateScore(layout); s > bestScore && allowed(layout, constraints) {
+						best, bestScore, found = r, s, true
+					}
+					// rotating twice more returns the original layout
+					rotate(layout, r)
+					rotate(layout, r)
+				}
+			}
+		}
+	}
+	if !found {
+		return false, score
+	}
+	rotate(layout, best)
+	return true, bestScore
+}
+
+// Moves the key on r[0] to r[1], r[1] to r[2] and r[2] to r[0]
+func rotate(layout *kbdlayout.KeyboardLayout, r [3]int) {
+	layout[r[0]], layout[r[1]], layout[r[2]] = layout[r[2]], layout[r[0]], layout[r[1]]
+}
@@ -0,0 +1,101 @@
+package gen
+
+import "sync"
+import "time"
+import "context"
+import "runtime"
+
+import "../kbdscoring"
+
+// Starts a worker of the optimizer of the options for each island. The
+// workers send the best of each of their generations to the returned
+// channel until the context is done, and the channel is closed when all
+// of them have stopped. The channel has to be read until then, or the
+// workers wait for it.
+//
+// Fails without starting anything if the options are not valid. MaxProcs
+// is applied with runtime.GOMAXPROCS, which is for the whole program,
+// so the runs at the same time should have the same MaxProcs.
+func Start(ctx context.Context, sf kbdscoring.ScoringFunction, opts *Options) (<-chan *LayoutEntry, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	// validated above
+	worker, _ := LookupOptimizer(opts.Optimizer)
+	runtime.GOMAXPROCS(opts.MaxProcs)
+
+	// make the buffer size the number of workers so no goroutine will need to pend writing
+	generationBest := make(chan *LayoutEntry, opts.Workers)
+
+	var running sync.WaitGroup
+	for _, island := range opts.NewIslands() {
+		running.Add(1)
+		go func(island *Island) {
+			defer running.Done()
+			worker(sf, opts, island, generationBest, ctx.Done())
+		}(island)
+	}
+	go func() {
+		running.Wait()
+		close(generationBest)
+	}()
+
+	return generationBest, nil
+}
+
+// Outcome of Run
+type Result struct {
+	Best        *LayoutEntry // nil if no generation finished
+	Generations uint64       // over all the workers
+	Elapsed     time.Duration
+}
+
+// Called by Run with the best of each generation of each worker, in the
+// order they arrive, with the number of generations so far and whether
+// the entry is the best so far. Returning true stops Run. The entry may
+// be changed, e.g. polished, and when that makes it better than the best
+// so far, it becomes the best of the result.
+type Observer func(entry *LayoutEntry, generation uint64, improved bool) (stop bool)
+
+// Searches layouts with the workers of the options until the context is
+// done or the observer, which can be nil, tells to stop. Returns when
+// all the workers have stopped, with the best layout found.
+//
+// The error is the one of the context if it ended the run, e.g.
+// context.DeadlineExceeded after a timeout, which still gives a result,
+// or the one of Start without a result.
+func Run(ctx context.Context, sf kbdscoring.ScoringFunction, opts *Options, observe Observer) (*Result, error) {
+	// the workers are stopped by cancel when the observer wants to stop
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	generationBest, err := Start(runCtx, sf, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	started := time.Now()
+	result := &Result{}
+	for entry := range generationBest {
+		if runCtx.Err() != nil {
+			// stopping, just let the workers finish
+			continue
+		}
+
+		result.Generations++
+		improved := result.Best == nil || entry.Score > result.Best.Score
+		if improved {
+			result.Best = entry
+		}
+		if observe != nil && observe(entry, result.Generations, improved) {
+			cancel()
+		}
+		if entry.Score > result.Best.Score {
+			// changed by the observer
+			result.Best = entry
+		}
+	}
+	result.Elapsed = time.Since(started)
+
+	return result, ctx.Err()
+}
@@ -0,0 +1,148 @@
+package gen
+
+import "time"
+import "context"
+import "runtime"
+import "testing"
+
+import "../kbdlayout"
+
+// Scores a layout higher the closer its character ids are to their
+// positions, cheap enough that the workers make many generations
+type positionScore struct{}
+
+func (positionScore) Init(mapping *kbdlayout.KeyboardMapping) {}
+
+func (positionScore) CalculateScore(layout *kbdlayout.KeyboardLayout) uint64 {
+	var score uint64
+	for pos, charId := range layout {
+		if int(charId) == pos {
+			score += 10
+		}
+		score += uint64(charId) * uint64(pos%7)
+	}
+	return score
+}
+
+func (positionScore) NormalizeScore(score uint64) float64 {
+	return float64(score)
+}
+
+func testOptions(optimizer string) *Options {
+	opts := DefaultOptions()
+	opts.Optimizer = optimizer
+	opts.Workers = 3
+	opts.MaxProcs = 2
+	opts.Seed = 1
+	return &opts
+}
+
+func TestRunStopsWhenCancelled(t *testing.T) {
+	for _, optimizer := range OptimizerNames() {
+		ctx, cancel := context.WithCancel(context.Background())
+		result, err := Run(ctx, positionScore{}, testOptions(optimizer), func(entry *LayoutEntry, generation uint64, improved bool) bool {
+			if generation == 5 {
+				cancel()
+			}
+			return false
+		})
+		if err != context.Canceled {
+			t.Fatalf("%s: error %v, want %v", optimizer, err, context.Canceled)
+		}
+		if result == nil || result.Best == nil {
+			t.Fatalf("%s: no best layout after cancelling", optimizer)
+		}
+		if result.Generations != 5 {
+			t.Errorf("%s: %d generations observed, want 5", optimizer, result.Generations)
+		}
+	}
+}
+
+func TestRunStopsAtDeadline(t *testing.T) {
+	for _, optimizer := range OptimizerNames() {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		result, err := Run(ctx, positionScore{}, testOptions(optimizer), nil)
+		cancel()
+		if err != context.DeadlineExceeded {
+			t.Fatalf("%s: error %v, want %v", optimizer, err, context.DeadlineExceeded)
+		}
+		if result == nil || result.Best == nil {
+			t.Fatalf("%s: no best layout at the deadline", optimizer)
+		}
+		if result.Elapsed > 10*time.Second {
+			t.Errorf("%s: stopped %s after the deadline", optimizer, result.Elapsed)
+		}
+	}
+}
+
+func TestRunStopsWhenObserverSays(t *testing.T) {
+	for _, optimizer := range OptimizerNames() {
+		var calls uint64
+		var best uint64
+		result, err := Run(context.Background(), positionScore{}, testOptions(optimizer), func(entry *LayoutEntry, generation uint64, improved bool) bool {
+			calls++
+			if improved {
+				best = entry.Score
+			}
+			return generation == 10
+		})
+		if err != nil {
+			t.Fatalf("%s: error %v after the observer stopped the run", optimizer, err)
+		}
+		if calls != 10 || result.Generations != 10 {
+			t.Errorf("%s: observer called %d times for %d generations, want 10", optimizer, calls, result.Generations)
+		}
+		if result.Best == nil || result.Best.Score != best {
+			t.Errorf("%s: best of the result is %v, want the score %d", optimizer, result.Best, best)
+		}
+	}
+}
+
+func TestRunKeepsEntriesImprovedByObserver(t *testing.T) {
+	var polished *LayoutEntry
+	result, err := Run(context.Background(), positionScore{}, testOptions("genetic"), func(entry *LayoutEntry, generation uint64, improved bool) bool {
+		if polished == nil && !improved {
+			// better than anything the workers find
+			entry.Score = 1 << 40
+			polished = entry
+		}
+		return generation == 50
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if polished == nil {
+		t.Fatal("every generation improved, none to improve in the observer")
+	}
+	if result.Best != polished {
+		t.Errorf("best of the result is %v, want the entry improved by the observer %v", result.Best, polished)
+	}
+}
+
+func TestStartRejectsInvalidOptions(t *testing.T) {
+	opts := testOptions("no-such-optimizer")
+	if _, err := Start(context.Background(), positionScore{}, opts); err == nil {
+		t.Error("started with an unknown optimizer")
+	}
+	if _, err := Run(context.Background(), positionScore{}, opts, nil); err == nil {
+		t.Error("ran with an unknown optimizer")
+	}
+}
+
+func TestStartAppliesMaxProcs(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(0))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	opts := testOptions("genetic")
+	opts.MaxProcs = 1
+	generationBest, err := Start(ctx, positionScore{}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if procs := runtime.GOMAXPROCS(0); procs != 1 {
+		t.Errorf("GOMAXPROCS is %d, want MaxProcs 1", procs)
+	}
+	cancel()
+	for range generationBest {
+	}
+}
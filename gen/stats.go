@@ -0,0 +1,160 @@
+package gen
+
+import "math"
+import "time"
+import "sync/atomic"
+
+// Counts where the time of the workers goes. The workers record into
+// the Stats of their options when it is set, and it can be read while
+// they run.
+type Stats struct {
+	started time.Time
+	workers []workerStats
+}
+
+// updated with atomics by the worker, read by anyone
+type workerStats struct {
+	generations uint64
+	evaluations uint64
+	// nanoseconds spent on each part of the generations
+	scoring  int64
+	sorting  int64
+	breeding int64
+	waiting  int64 // for generationBest to be read
+
+	// latest state of the population of EvolvePopulation
+	diversity      uint64 // float64 bits
+	randomized     int64
+	mutationFactor int64
+}
+
+// Creates the stats for the workers, the time they have run is counted
+// from now on
+func NewStats(workers int) *Stats {
+	return &Stats{started: time.Now(), workers: make([]workerStats, workers)}
+}
+
+// Returns the stats of the worker of the island, nil if there are no
+// stats, which the methods of workerStats ignore
+func (s *Stats) worker(island *Island) *workerStats {
+	if s == nil || island.ID() >= len(s.workers) {
+		return nil
+	}
+	return &s.workers[island.ID()]
+}
+
+// Adds the time since start to the part and returns the current time
+// to start the next part from
+func (w *workerStats) add(part *int64, start time.Time) time.Time {
+	now := time.Now()
+	if w != nil {
+		atomic.AddInt64(part, int64(now.Sub(start)))
+	}
+	return now
+}
+
+func (w *workerStats) scored(start time.Time, evaluations int) time.Time {
+	if w == nil {
+		return time.Now()
+	}
+	atomic.AddUint64(&w.evaluations, uint64(evaluations))
+	return w.add(&w.scoring, start)
+}
+
+func (w *workerStats) sorted(start time.Time) time.Time {
+	if w == nil {
+		return time.Now()
+	}
+	return w.add(&w.sorting, start)
+}
+
+func (w *workerStats) bred(start time.Time) time.Time {
+	if w == nil {
+		return time.Now()
+	}
+	return w.add(&w.breeding, start)
+}
+
+// Counts a generation sent after waiting since start
+func (w *workerStats) sent(start time.Time) time.Time {
+	if w == nil {
+		return time.Now()
+	}
+	atomic.AddUint64(&w.generations, 1)
+	return w.add(&w.waiting, start)
+}
+
+// Sets the diversity of the population and the rates adapted to it
+func (w *workerStats) adapted(diversity float64, randomized int, mutationFactor int) {
+	if w == nil {
+		return
+	}
+	atomic.StoreUint64(&w.diversity, math.Float64bits(diversity))
+	atomic.StoreInt64(&w.randomized, int64(randomized))
+	atomic.StoreInt64(&w.mutationFactor, int64(mutationFactor))
+}
+
+// Snapshot of the stats of a worker, the times are in seconds
+type WorkerStats struct {
+	Worker               int     `json:"worker"`
+	Generations          uint64  `json:"generations"`
+	Evaluations          uint64  `json:"evaluations"`
+	EvaluationsPerSecond float64 `json:"evaluations-per-second"`
+	Scoring              float64 `json:"scoring"`
+	Sorting              float64 `json:"sorting"`
+	Breeding             float64 `json:"breeding"`
+	Waiting              float64 `json:"waiting"`
+
+	// of the genetic algorithm, see Options.MinDiversity
+	Diversity      float64 `json:"diversity"`
+	Randomized     int     `json:"randomized"`
+	MutationFactor int     `json:"mutation-factor"`
+}
+
+// Returns the stats of each worker so far
+func (s *Stats) Workers() []WorkerStats {
+	elapsed := time.Since(s.started).Seconds()
+	seconds := func(part *int64) float64 {
+		return time.Duration(atomic.LoadInt64(part)).Seconds()
+	}
+
+	workers := make([]WorkerStats, len(s.workers))
+	for i := range s.workers {
+		w := &s.workers[i]
+		workers[i] = WorkerStats{
+			Worker:      i,
+			Generations: atomic.LoadUint64(&w.generations),
+			Evaluations: atomic.LoadUint64(&w.evaluations),
+			Scoring:     seconds(&w.scoring),
+			Sorting:     seconds(&w.sorting),
+			Breeding:    seconds(&w.breeding),
+			Waiting:     seconds(&w.waiting),
+
+			Diversity:      math.Float64frombits(atomic.LoadUint64(&w.diversity)),
+			Randomized:     int(atomic.LoadInt64(&w.randomized)),
+			MutationFactor: int(atomic.LoadInt64(&w.mutationFactor)),
+		}
+		if elapsed > 0 {
+			workers[i].EvaluationsPerSecond = float64(workers[i].Evaluations) / elapsed
+		}
+	}
+	return workers
+}
+
+// Returns the stats of all the workers added up, with Worker -1. The
+// diversity is the average of the workers, the rates are left out.
+func (s *Stats) Total() WorkerStats {
+	total := WorkerStats{Worker: -1}
+	workers := s.Workers()
+	for _, w := range workers {
+		total.Generations += w.Generations
+		total.Evaluations += w.Evaluations
+		total.EvaluationsPerSecond += w.EvaluationsPerSecond
+		total.Scoring += w.Scoring
+		total.Sorting += w.Sorting
+		total.Breeding += w.Breeding
+		total.Waiting += w.Waiting
+		total.Diversity += w.Diversity / float64(len(workers))
+	}
+	return total
+}
@@ -0,0 +1,172 @@
+package gen
+
+import "fmt"
+import "sort"
+import "time"
+
+import "../kbdscoring"
+
+// Worker searches for layouts until done is closed, sending its
+// best of each generation to generationBest. EvolvePopulation and
+// TabuSearch are workers.
+type Worker func(sf kbdscoring.ScoringFunction, opts *Options, island *Island, generationBest chan<- *LayoutEntry, done <-chan struct{})
+
+// Optimizers selectable by name with Options.Optimizer
+var Optimizers = map[string]Worker{
+	"genetic": EvolvePopulation,
+	"tabu":    TabuSearch,
+}
+
+// Returns the names of the optimizers in alphabetical order
+func OptimizerNames() []string {
+	names := make([]string, 0, len(Optimizers))
+	for name := range Optimizers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Finds an optimizer by its name
+func LookupOptimizer(name string) (Worker, error) {
+	worker, ok := Optimizers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown optimizer '%s', use one of %v", name, OptimizerNames())
+	}
+	return worker, nil
+}
+
+// Searches layouts with tabu search until done is closed.
+//
+// On each generation every swap of two keys is scored and the best one
+// is made, even if it makes the layout worse, which lets the search walk
+// out of local maximums. To not walk straight back in, the pair of
+// positions swapped is tabu, not swapped again, for the next TabuTenure
+// generations, unless swapping it would give a layout better than any
+// found so far by any of the workers (aspiration). When the best of the
+// worker hasn't improved in TabuRestart generations, the search starts
+// over from the best migrant of the neighbouring islands, or from a random
+// layout if none has arrived.
+//
+// The current layout of each generation is sent to generationBest.
+func TabuSearch(sf kbdscoring.ScoringFunction, opts *Options, island *Island, generationBest chan<- *LayoutEntry, done <-chan struct{}) {
+
+	rng := opts.newRand(island)
+	stats := opts.Stats.worker(island)
+	var evaluations uint64
+
+	var current LayoutEntry
+	restart := func() {
+		// migrants are the best of the other islands, which makes them
+		// a better starting point than a random layout
+		arrival, ok := island.bestImmigrant()
+		if !ok {
+			randomizeLayout(rng, &arrival.Layout)
+			enforce(rng, &arrival.Layout, opts.Constraints)
+		}
+		current = arrival
+		current.Score = sf.CalculateScore(&current.Layout)
+		evaluations++
+		if !allowed(&current.Layout, opts.Constraints) {
+			// the constraints could not be enforced, or changed since the
+			// migrant left, it is only a starting point for the moves
+			current.Score = 0
+		}
+	}
+	restart()
+
+	// best of the worker for migration, shared with the other workers
+	// for aspiration, and the best since the last restart for deciding
+	// when to restart
+	best := current
+	island.offerBest(best.Score)
+	runBest := current.Score
+	var lastImprovement uint64
+
+	// generation until which swapping each pair of positions is tabu
+	var tabu [30][30]uint64
+
+	var generation uint64
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+
+		generation++
+		start := time.Now()
+
+		// a tabu swap is made if it beats the best of all the workers
+		aspiration := best.Score
+		if shared := island.bestScore(); shared > aspiration {
+			aspiration = shared
+		}
+
+		bestI, bestJ := -1, -1
+		var bestScore uint64
+		layout := &current.Layout
+		for i := 0; i < 30; i++ {
+			for j := i + 1; j < 30; j++ {
+				layout[i], layout[j] = layout[j], layout[i]
+				score := sf.CalculateScore(layout)
+				evaluations++
+				ok := (bestI < 0 || score > bestScore) &&
+					(tabu[i][j] < generation || score > aspiration) &&
+					allowed(layout, opts.Constraints)
+				layout[i], layout[j] = layout[j], layout[i]
+				if ok {
+					bestI, bestJ, bestScore = i, j, score
+				}
+			}
+		}
+
+		start = stats.scored(start, 30*29/2)
+
+		if bestI >= 0 {
+			layout[bestI], layout[bestJ] = layout[bestJ], layout[bestI]
+			current.Score = bestScore
+			tabu[bestI][bestJ] = generation + uint64(opts.TabuTenure)
+		}
+
+		if current.Score > best.Score {
+			best = current
+			island.offerBest(best.Score)
+		}
+		if current.Score > runBest {
+			runBest = current.Score
+			lastImprovement = generation
+		}
+
+		// the best of the worker is its population for migration
+		island.emigrate([]LayoutEntry{best}, generation)
+		start = stats.bred(start)
+
+		select {
+		case generationBest <- &LayoutEntry{
+			Score:      current.Score,
+			Layout:     current.Layout,
+			Worker:     island.ID(),
+			Generation: generation,
+
+			Evaluations: evaluations,
+		}:
+		case <-done:
+			return
+		}
+		start = stats.sent(start)
+
+		if bestI < 0 || opts.TabuRestart > 0 && generation-lastImprovement >= opts.TabuRestart {
+			// stuck, every move is tabu or nothing has improved in a while
+			restart()
+			if current.Score > best.Score {
+				best = current
+				island.offerBest(best.Score)
+			}
+			runBest = current.Score
+			lastImprovement = generation
+			tabu = [30][30]uint64{}
+			stats.scored(start, 1)
+		}
+	}
+}
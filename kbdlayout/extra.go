@@ -0,0 +1,32 @@
+package kbdlayout
+
+import "fmt"
+
+// Key outside the 3x10 block, right of its right edge like the keys
+// right of p and ö on the ISO keyboards. The right pinky types them,
+// reaching further than for the last column of the block.
+type ExtraKey struct {
+	Row    int // 0..2 like the rows of the block
+	Column int // 10 for the column next to the block, 11 for the one after it
+}
+
+// Extra keys in the order they are filled: the characters a language
+// has more than the 30 keys go next to the home and top rows first, as
+// on the keyboards of the languages. Extra key i is position 30+i.
+var ExtraKeys = []ExtraKey{
+	{Row: 0, Column: 10},
+	{Row: 1, Column: 10},
+	{Row: 0, Column: 11},
+	{Row: 1, Column: 11},
+}
+
+// Returns the position 0..29 in the last column of the block,
+// on the same row as the extra key
+func (k ExtraKey) Neighbour() int {
+	return k.Row*10 + 9
+}
+
+// Describes the extra key for people, e.g. "top 10"
+func (k ExtraKey) String() string {
+	return fmt.Sprintf("%s %d", rowNames[k.Row], k.Column)
+}
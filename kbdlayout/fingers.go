@@ -0,0 +1,78 @@
+package kbdlayout
+
+import "fmt"
+
+type Hand int
+
+const (
+	Left Hand = iota
+	Right
+)
+
+func (h Hand) String() string {
+	if h == Left {
+		return "left"
+	}
+	return "right"
+}
+
+type Finger int
+
+const (
+	LeftPinky Finger = iota
+	LeftRing
+	LeftMiddle
+	LeftIndex
+	RightIndex
+	RightMiddle
+	RightRing
+	RightPinky
+)
+
+var fingerNames = [8]string{
+	"left pinky", "left ring", "left middle", "left index",
+	"right index", "right middle", "right ring", "right pinky",
+}
+
+func (f Finger) String() string {
+	return fingerNames[f]
+}
+
+func (f Finger) Hand() Hand {
+	if f <= LeftIndex {
+		return Left
+	}
+	return Right
+}
+
+// fingers for each column when touch typing,
+// index fingers take care of the two middle columns
+var columnFingers = [10]Finger{
+	LeftPinky, LeftRing, LeftMiddle, LeftIndex, LeftIndex,
+	RightIndex, RightIndex, RightMiddle, RightRing, RightPinky,
+}
+
+// Returns the finger that types the key in the position 0..29
+func FingerOf(pos int) Finger {
+	return columnFingers[pos%10]
+}
+
+// Returns the number of positions that have a different
+// character on the layout than on the reference
+func MovedKeys(layout, reference *KeyboardLayout) int {
+	moved := 0
+	for i := 0; i < 30; i++ {
+		if layout[i] != reference[i] {
+			moved++
+		}
+	}
+	return moved
+}
+
+var rowNames = [3]string{"top", "home", "bottom"}
+
+// Describes the position 0..29 for people, e.g. "home 3"
+// for the fourth key from the left on the home row
+func PositionName(pos int) string {
+	return fmt.Sprintf("%s %d", rowNames[pos/10], pos%10)
+}
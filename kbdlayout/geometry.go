@@ -0,0 +1,44 @@
+package kbdlayout
+
+import "math"
+
+// Physical arrangement of the 30 keys, giving the place of each
+// key in key widths (1u, about 19 mm on common keyboards)
+type Geometry struct {
+	Name string
+	// horizontal offset of each row from the left edge of the top row,
+	// e.g. 0.25 for the home row on a row staggered keyboard
+	RowOffsets [3]float64
+}
+
+// Common geometries by their names, as in the geometry of layout files
+var Geometries = map[string]*Geometry{
+	// usual keyboard, with rows shifted to the right going down
+	"staggered": &Geometry{Name: "staggered", RowOffsets: [3]float64{0, 0.25, 0.75}},
+	// keys in a straight grid
+	"ortholinear": &Geometry{Name: "ortholinear", RowOffsets: [3]float64{0, 0, 0}},
+}
+
+// width of a key in millimetres on common keyboards
+const KeyWidthMM = 19.05
+
+// Returns the center of the key in the position 0..29, in key widths
+func (g *Geometry) KeyCenter(pos int) (x, y float64) {
+	row := pos / 10
+	return float64(pos%10) + g.RowOffsets[row] + 0.5, float64(row) + 0.5
+}
+
+// Returns the distance between the centers of two keys, in key widths
+func (g *Geometry) Distance(from, to int) float64 {
+	x1, y1 := g.KeyCenter(from)
+	x2, y2 := g.KeyCenter(to)
+	return math.Hypot(x2-x1, y2-y1)
+}
+
+// positions the fingers rest on when touch typing
+var homePositions = [8]int{10, 11, 12, 13, 16, 17, 18, 19}
+
+// Returns the position 0..29 the finger rests on
+func HomePosition(f Finger) int {
+	return homePositions[f]
+}
@@ -21,29 +21,79 @@ type KeyboardLayout [30]uint8
 type KeyboardMapping struct {
 	ID2Rune []rune // will be limited to 256, as we're using uint8
 	Rune2ID map[rune]uint8
+
+	// language specific rules for lowercasing, nil for the default rules
+	caseMapping unicode.SpecialCase
+	// characters the language types with the keys of others
+	folds map[rune]rune
 }
 
 func NewMapping(keys string) *KeyboardMapping {
+	return NewLocaleMapping(keys, "")
+}
+
+// language specific lowercasing rules by language code
+var localeCases = map[string]unicode.SpecialCase{
+	"tr": unicode.TurkishCase,
+	"az": unicode.AzeriCase,
+}
+
+// Returns the special case rules of the language, nil for the
+// languages without them, which use the default rules
+func LocaleCase(locale string) unicode.SpecialCase {
+	return localeCases[locale]
+}
+
+// characters typed with the key of another one by language code, like
+// the letters French types with a dead key for the accent and the key
+// of the letter, or the ones borrowed from other languages
+var localeFolds = map[string]map[rune]rune{
+	"fi": {'š': 's', 'ž': 'z', 'ü': 'y', 'é': 'e'},
+	"de": {'é': 'e', 'è': 'e', 'à': 'a', 'ç': 'c', 'ñ': 'n'},
+	"fr": {'â': 'a', 'ê': 'e', 'î': 'i', 'ô': 'o', 'û': 'u', 'ë': 'e', 'ï': 'i', 'ü': 'u', 'ÿ': 'y', 'ù': 'u'},
+}
+
+// Creates a mapping that lowercases characters with the rules of the
+// language, e.g. "tr" lowercases I to dotless ı. Languages without
+// special rules, or empty locale, use the default rules. Characters
+// that the language types with the key of another, like ê with the
+// key of e in "fr", count as that one if the keys don't have them.
+func NewLocaleMapping(keys string, locale string) *KeyboardMapping {
 	runeCount := utf8.RuneCountInString(keys)
 	if runeCount > 256 {
 		log.Fatalf("KeyboardMapping currently supports only up to 256 characters. (got %d)", runeCount)
 	}
 	mapping := &KeyboardMapping{
-		ID2Rune: make([]rune, runeCount),
-		Rune2ID: make(map[rune]uint8),
+		ID2Rune:     make([]rune, runeCount),
+		Rune2ID:     make(map[rune]uint8),
+		caseMapping: LocaleCase(locale),
 	}
 
 	for i := 0; i < runeCount; i++ {
 		character, size := utf8.DecodeRuneInString(keys)
-		character = unicode.ToLower(character)
+		character = mapping.caseMapping.ToLower(character)
 		keys = keys[size:]
 		mapping.ID2Rune[i] = character
 		mapping.Rune2ID[character] = uint8(i) // will stay below 256
 	}
+	mapping.folds = localeFolds[locale]
 
 	return mapping
 }
 
+// Lowercases the character with the rules of the mapping's language,
+// and folds it to the character the language types it with if the
+// mapping doesn't have it
+func (m *KeyboardMapping) ToLower(r rune) rune {
+	lower := m.caseMapping.ToLower(r)
+	if _, ok := m.Rune2ID[lower]; !ok {
+		if folded, ok := m.folds[lower]; ok {
+			return folded
+		}
+	}
+	return lower
+}
+
 const (
 	Qwerty  = "qwertyuiopasdfghjkl;zxcvbnm.,/"
 	Abcde   = "abcdefghijklmnopqrstuvwxyz.,;/"
@@ -56,26 +106,84 @@ const (
 )
 
 func NewLayout(l string, m *KeyboardMapping) KeyboardLayout {
+	layout, err := ParseLayout(l, m)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return layout
+}
+
+// Creates a layout from 30 characters, returns an error if
+// there are not 30 or the mapping doesn't have all of them
+func ParseLayout(l string, m *KeyboardMapping) (KeyboardLayout, error) {
 	layout := [30]uint8{}
+	if runeCount := utf8.RuneCountInString(l); runeCount != 30 {
+		return layout, fmt.Errorf("layout needs 30 characters, got %d", runeCount)
+	}
 	for i := 0; i < 30; i++ {
 		character, size := utf8.DecodeRuneInString(l)
-		character = unicode.ToLower(character)
+		character = m.ToLower(character)
 		id, ok := m.Rune2ID[character]
 		if !ok {
-			log.Fatalf("could not map %c on the layout", character)
+			return layout, fmt.Errorf("could not map %c on the layout", character)
 		}
 		layout[i] = id
 		l = l[size:]
 	}
-	return KeyboardLayout(layout)
+	return KeyboardLayout(layout), nil
 }
 
 func (m *KeyboardMapping) PrintLayout(l *KeyboardLayout) {
+	for _, row := range m.LayoutRows(l) {
+		fmt.Println(row)
+	}
+}
+
+// Returns the three rows of the layout as PrintLayout prints them
+func (m *KeyboardMapping) LayoutRows(l *KeyboardLayout) [3]string {
 	k := [30]rune{}
 	for i := 0; i < 30; i++ {
 		k[i] = m.ID2Rune[l[i]]
 	}
-	fmt.Printf("%c%c%c%c %c  %c %c%c%c%c\n", k[0], k[1], k[2], k[3], k[4], k[5], k[6], k[7], k[8], k[9])
-	fmt.Printf("%c%c%c%c %c  %c %c%c%c%c\n", k[10], k[11], k[12], k[13], k[14], k[15], k[16], k[17], k[18], k[19])
-	fmt.Printf("%c%c%c%c %c  %c %c%c%c%c\n", k[20], k[21], k[22], k[23], k[24], k[25], k[26], k[27], k[28], k[29])
+	rows := [3]string{}
+	for row := 0; row < 3; row++ {
+		r := k[row*10 : row*10+10]
+		rows[row] = fmt.Sprintf("%c%c%c%c %c  %c %c%c%c%c", r[0], r[1], r[2], r[3], r[4], r[5], r[6], r[7], r[8], r[9])
+	}
+	return rows
+}
+
+// Returns the layout as a string of 30 characters, which can
+// be given back to NewLayout
+func (m *KeyboardMapping) LayoutString(l *KeyboardLayout) string {
+	k := make([]rune, 30)
+	for i := 0; i < 30; i++ {
+		k[i] = m.ID2Rune[l[i]]
+	}
+	return string(k)
+}
+
+// Returns the minimum number of swaps needed to turn layout a into
+// layout b. Both layouts need to have the same characters.
+func SwapDistance(a, b *KeyboardLayout) int {
+	// position of each character on b
+	var positions [256]int
+	for i := 0; i < 30; i++ {
+		positions[b[i]] = i
+	}
+
+	// each cycle of n positions, where the character on a needs to
+	// move to the next position, takes n-1 swaps to fix
+	var visited [30]bool
+	cycles := 0
+	for start := 0; start < 30; start++ {
+		if visited[start] {
+			continue
+		}
+		cycles++
+		for pos := start; !visited[pos]; pos = positions[a[pos]] {
+			visited[pos] = true
+		}
+	}
+	return 30 - cycles
 }
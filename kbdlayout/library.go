@@ -0,0 +1,172 @@
+package kbdlayout
+
+import "os"
+import "io"
+import "fmt"
+import "sort"
+import "bufio"
+import "strconv"
+import "strings"
+import "path/filepath"
+import "unicode/utf8"
+
+// Known layout with its description. Layout files look like this:
+//
+//	# comments and empty lines are ignored
+//	name: colemak-dh
+//	title: Colemak Mod-DH
+//	author: the author, if known
+//	year: the year it was published, if known
+//	language: en
+//	geometry: 3x10
+//	layer: qwfpb jluy; arstg mneio zxcdv kh,./
+//
+// Spaces in the layers are ignored. The first layer is the one
+// scored and generated, the others are for information only.
+type LayoutInfo struct {
+	Name     string // used to find the layout, e.g. in -layout
+	Title    string
+	Author   string
+	Year     int
+	Language string
+	Geometry string
+	Layers   []string
+	File     string // where the layout was loaded from, empty for built-in ones
+}
+
+// Returns the characters of the first layer
+func (info *LayoutInfo) Base() string {
+	return info.Layers[0]
+}
+
+// Layout file extension
+const LayoutFileExt = ".layout"
+
+// Parses a layout file
+func ParseLayoutInfo(r io.Reader, filename string) (*LayoutInfo, error) {
+	info := &LayoutInfo{File: filename}
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		keyAndValue := strings.SplitN(line, ":", 2)
+		if len(keyAndValue) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected 'key: value'", filename, lineNumber)
+		}
+		key := strings.TrimSpace(keyAndValue[0])
+		value := strings.TrimSpace(keyAndValue[1])
+
+		switch key {
+		case "name":
+			info.Name = value
+		case "title":
+			info.Title = value
+		case "author":
+			info.Author = value
+		case "year":
+			year, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: invalid year: %v", filename, lineNumber, err)
+			}
+			info.Year = year
+		case "language":
+			info.Language = value
+		case "geometry":
+			info.Geometry = value
+		case "layer":
+			layer := strings.Replace(value, " ", "", -1)
+			if runeCount := utf8.RuneCountInString(layer); runeCount != 30 {
+				return nil, fmt.Errorf("%s:%d: layer needs 30 characters, got %d", filename, lineNumber, runeCount)
+			}
+			info.Layers = append(info.Layers, layer)
+		default:
+			return nil, fmt.Errorf("%s:%d: unknown key '%s'", filename, lineNumber, key)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if info.Name == "" {
+		// default to the file name without extension
+		info.Name = strings.TrimSuffix(filepath.Base(filename), LayoutFileExt)
+	}
+	if len(info.Layers) == 0 {
+		return nil, fmt.Errorf("%s: no layers", filename)
+	}
+	return info, nil
+}
+
+// Collection of known layouts by their names
+type Library struct {
+	layouts map[string]*LayoutInfo
+}
+
+// Creates a library with the layouts defined in this package
+func NewLibrary() *Library {
+	library := &Library{layouts: map[string]*LayoutInfo{}}
+	for name, layout := range map[string]string{
+		"qwerty":  Qwerty,
+		"abcde":   Abcde,
+		"dvorak":  Dvorak,
+		"colemak": Colemak,
+		"asset":   Asset,
+		"workman": Workman,
+		"nail":    Nail,
+		"layman":  Layman,
+	} {
+		library.Add(&LayoutInfo{Name: name, Geometry: "3x10", Layers: []string{layout}})
+	}
+	return library
+}
+
+// Adds the layout, replacing any layout with the same name
+func (l *Library) Add(info *LayoutInfo) {
+	l.layouts[info.Name] = info
+}
+
+// Loads all the layout files in the directory
+func (l *Library) LoadDir(dir string) error {
+	if _, err := os.Stat(dir); err != nil {
+		return err
+	}
+	filenames, err := filepath.Glob(filepath.Join(dir, "*"+LayoutFileExt))
+	if err != nil {
+		return err
+	}
+
+	for _, filename := range filenames {
+		file, err := os.Open(filename)
+		if err != nil {
+			return err
+		}
+		info, err := ParseLayoutInfo(file, filename)
+		file.Close()
+		if err != nil {
+			return err
+		}
+		l.Add(info)
+	}
+	return nil
+}
+
+// Finds a layout by its name
+func (l *Library) Lookup(name string) (*LayoutInfo, bool) {
+	info, ok := l.layouts[name]
+	return info, ok
+}
+
+// Returns the names of all the layouts in alphabetical order
+func (l *Library) Names() []string {
+	names := make([]string, 0, len(l.layouts))
+	for name := range l.layouts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,58 @@
+package kbdscoring
+
+import "log"
+
+import "../kbdlayout"
+
+// Scoring functions that normalize their scores against a baseline
+// layout implement this, so the baseline can be changed before Init.
+type Baseliner interface {
+	// Sets the characters of the baseline layout,
+	// empty string for the default (qwerty)
+	SetBaseline(layout string)
+}
+
+// Normalizes scores so that the baseline layout scores 1.0
+type Normalizer struct {
+	baseline      string
+	baselineScore uint64
+}
+
+func (n *Normalizer) SetBaseline(layout string) {
+	n.baseline = layout
+}
+
+// Scores the baseline with the mapping. If the baseline can't be built
+// from the characters of the mapping, the characters are used in the
+// order of the mapping instead. If there are not enough of them either,
+// scores will not be normalized.
+func (n *Normalizer) initBaseline(mapping *kbdlayout.KeyboardMapping, calculateScore func(*kbdlayout.KeyboardLayout) uint64) {
+	n.baselineScore = 0
+
+	baseline := n.baseline
+	if baseline == "" {
+		baseline = kbdlayout.Qwerty
+	}
+
+	layout, err := kbdlayout.ParseLayout(baseline, mapping)
+	if err != nil {
+		if len(mapping.ID2Rune) < 30 {
+			log.Printf("can't use baseline '%s' (%v), scores will not be normalized", baseline, err)
+			return
+		}
+		log.Printf("can't use baseline '%s' (%v), using characters in the mapping order instead", baseline, err)
+		for i := 0; i < 30; i++ {
+			layout[i] = uint8(i)
+		}
+	}
+
+	n.baselineScore = calculateScore(&layout)
+}
+
+// Normalize score so that the baseline is 1.0
+func (n *Normalizer) NormalizeScore(score uint64) float64 {
+	if n.baselineScore == 0 {
+		return float64(score)
+	}
+	return float64(score) / float64(n.baselineScore)
+}
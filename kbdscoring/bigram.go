@@ -1,16 +1,20 @@
 package kbdscoring
 
-import "os"
 import "log"
-import "unicode"
 import "unicode/utf8"
 import "strconv"
 import "bufio"
 import "../kbdlayout"
 
 type BigramScoringFunc struct {
-	bigrams     [][]uint64 // bigrams[mapping.Rune2ID['e']][mapping.Rune2ID['s']] = 5234
-	qwertyScore uint64     // will be used for normalizing
+	File string // bigram counts, bigrams.txt if empty
+
+	// bigram counts in one block of memory, a row of 256 for each first
+	// character: bigrams[256*mapping.Rune2ID['e']+mapping.Rune2ID['s']] = 5234.
+	// A row has room for every character id, so indexing it needs no bounds
+	// check, and only the start of it is used, so the rest is never cached.
+	bigrams    []uint64
+	Normalizer // the baseline is qwerty unless set otherwise
 }
 
 // will be mirrored to right side
@@ -152,17 +156,29 @@ func prepareWeights() {
 	}
 }
 
+// Returns the highest weight of any pair of keys
+func maxBigramWeight() uint64 {
+	var maxWeight uint64
+	for i := 0; i < 30; i++ {
+		for j := 0; j < 30; j++ {
+			if bigramKeyWeights[i][j] > maxWeight {
+				maxWeight = bigramKeyWeights[i][j]
+			}
+		}
+	}
+	return maxWeight
+}
+
 func (s *BigramScoringFunc) Init(mapping *kbdlayout.KeyboardMapping) {
-	file, err := os.Open("bigrams.txt")
-	if err != nil {
-		log.Fatal(err)
+	filename := s.File
+	if filename == "" {
+		filename = "bigrams.txt"
 	}
+	file := openCounts(filename)
+	defer file.Close()
 	scanner := bufio.NewScanner(file)
 
-	s.bigrams = make([][]uint64, len(mapping.ID2Rune))
-	for i := 0; i < len(mapping.ID2Rune); i++ {
-		s.bigrams[i] = make([]uint64, len(mapping.ID2Rune))
-	}
+	s.bigrams = make([]uint64, len(mapping.ID2Rune)*bigramRowLength)
 
 	for scanner.Scan() {
 		line := scanner.Text()
@@ -177,8 +193,8 @@ func (s *BigramScoringFunc) Init(mapping *kbdlayout.KeyboardMapping) {
 		line = line[size+1:]
 
 		// make letters lowercase
-		letter1 = unicode.ToLower(letter1)
-		letter2 = unicode.ToLower(letter2)
+		letter1 = mapping.ToLower(letter1)
+		letter2 = mapping.ToLower(letter2)
 
 		characterId1, ok := mapping.Rune2ID[letter1]
 		if !ok {
@@ -196,33 +212,104 @@ func (s *BigramScoringFunc) Init(mapping *kbdlayout.KeyboardMapping) {
 		if err != nil {
 			log.Fatal(err)
 		}
-		s.bigrams[characterId1][characterId2] = count
+		// characters folded to the same ones add up
+		s.bigrams[s.index(characterId1, characterId2)] += count
 	}
 
 	prepareWeights()
 
-	qwerty := kbdlayout.NewLayout(kbdlayout.Qwerty, mapping)
-	s.qwertyScore = s.CalculateScore(&qwerty)
+	// make sure the score fits in uint64 even with huge corpora
+	scaleCounts(filename, s.bigrams, maxBigramWeight())
+
+	// calculate the score for the baseline layout, so we can use it as a base.
+	s.initBaseline(mapping, s.CalculateScore)
 }
 
 func (s *BigramScoringFunc) CalculateScore(layout *kbdlayout.KeyboardLayout) uint64 {
 
 	var score uint64
 
+	// the scoring is the hot loop of the generator: the counts of each
+	// first character are a contiguous row of 256 and the weights are an
+	// array of 30, so the inner loop needs no bounds checks for them.
+	//
+	// The weights are not folded into the counts, as the weight of a
+	// bigram depends on the positions of its characters: a table by both
+	// would be 900 times the size of the counts. The counts and the weights
+	// that are used take 7 KB each, so they already stay in the L1 cache,
+	// and narrower counts would only limit the scaling of large corpora.
+	for i := 0; i < 30; i++ {
+		row := (*[bigramRowLength]uint64)(s.bigrams[int(layout[i])*bigramRowLength:])
+		weights := &bigramKeyWeights[i]
+		for j := 0; j < 30; j++ {
+			score += row[layout[j]] * weights[j]
+		}
+	}
+
+	return score
+}
+
+// length of a row of bigrams, the number of possible character ids
+const bigramRowLength = 256
+
+// Returns the index of the count of the bigram in bigrams
+func (s *BigramScoringFunc) index(charId1, charId2 uint8) int {
+	return int(charId1)*bigramRowLength + int(charId2)
+}
+
+// Score of the character typed twice in a row
+func (s *BigramScoringFunc) KeyScore(pos int, charId uint8) uint64 {
+	return s.bigrams[s.index(charId, charId)] * bigramKeyWeights[pos][pos]
+}
+
+// Score of the bigrams of the two characters, in both orders
+func (s *BigramScoringFunc) PairScore(pos1 int, charId1 uint8, pos2 int, charId2 uint8) uint64 {
+	return s.bigrams[s.index(charId1, charId2)]*bigramKeyWeights[pos1][pos2] +
+		s.bigrams[s.index(charId2, charId1)]*bigramKeyWeights[pos2][pos1]
+}
+
+// Contribution of one bigram to the score of a layout
+type BigramContribution struct {
+	First, Second       uint8 // character ids in the mapping
+	FirstPos, SecondPos int   // positions of the characters on the layout
+	Frequency           uint64
+	Weight              uint64
+	Score               uint64 // Frequency * Weight
+	Penalty             uint64 // score lost compared to having the best weight
+}
+
+// Returns the contribution of every bigram that occurs in the corpus,
+// in the order of the positions on the layout. The scores add up to
+// the score given by CalculateScore.
+func (s *BigramScoringFunc) Explain(layout *kbdlayout.KeyboardLayout) []BigramContribution {
+
+	maxWeight := maxBigramWeight()
+
+	var contributions []BigramContribution
+
 	for i := 0; i < 30; i++ {
 		charId1 := layout[i]
 		for j := 0; j < 30; j++ {
 			charId2 := layout[j]
 
-			bigramFrequency := s.bigrams[charId1][charId2]
+			bigramFrequency := s.bigrams[s.index(charId1, charId2)]
+			if bigramFrequency == 0 {
+				continue
+			}
 			bigramWeight := bigramKeyWeights[i][j]
 
-			score += bigramFrequency * bigramWeight
+			contributions = append(contributions, BigramContribution{
+				First:     charId1,
+				Second:    charId2,
+				FirstPos:  i,
+				SecondPos: j,
+				Frequency: bigramFrequency,
+				Weight:    bigramWeight,
+				Score:     bigramFrequency * bigramWeight,
+				Penalty:   bigramFrequency * (maxWeight - bigramWeight),
+			})
 		}
 	}
 
-	return score
-}
-func (s *BigramScoringFunc) NormalizeScore(score uint64) float64 {
-	return float64(score) / float64(s.qwertyScore)
+	return contributions
 }
@@ -0,0 +1,114 @@
+package kbdscoring
+
+import "os"
+import "fmt"
+import "bufio"
+import "testing"
+import "math/rand"
+import "path/filepath"
+
+import "../kbdlayout"
+
+// Creates a bigram scoring func with fixed synthetic counts for every
+// pair of the characters of the mapping, so no corpus is needed
+func syntheticBigrams(tb testing.TB, mapping *kbdlayout.KeyboardMapping) *BigramScoringFunc {
+	filename := filepath.Join(tb.TempDir(), "bigrams.txt")
+	file, err := os.Create(filename)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	writer := bufio.NewWriter(file)
+	for i, r1 := range mapping.ID2Rune {
+		for j, r2 := range mapping.ID2Rune {
+			fmt.Fprintf(writer, "%c%c %d\n", r1, r2, (i*31+j*17)%1000+1)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		tb.Fatal(err)
+	}
+	file.Close()
+
+	sf := &BigramScoringFunc{File: filename}
+	sf.Init(mapping)
+	return sf
+}
+
+// Random layouts to score, the same ones on every run
+func benchLayouts() []kbdlayout.KeyboardLayout {
+	rng := rand.New(rand.NewSource(1))
+	layouts := make([]kbdlayout.KeyboardLayout, 1024)
+	for i := range layouts {
+		for pos, charId := range rng.Perm(30) {
+			layouts[i][pos] = uint8(charId)
+		}
+	}
+	return layouts
+}
+
+// The scoring before the flat table, with the counts in a slice of
+// slices, for comparing the speed to
+type sliceOfSlicesBigrams [][]uint64
+
+func newSliceOfSlicesBigrams(sf *BigramScoringFunc, characters int) sliceOfSlicesBigrams {
+	bigrams := make(sliceOfSlicesBigrams, characters)
+	for i := range bigrams {
+		bigrams[i] = make([]uint64, characters)
+		for j := range bigrams[i] {
+			bigrams[i][j] = sf.bigrams[sf.index(uint8(i), uint8(j))]
+		}
+	}
+	return bigrams
+}
+
+func (bigrams sliceOfSlicesBigrams) CalculateScore(layout *kbdlayout.KeyboardLayout) uint64 {
+	var score uint64
+	for i := 0; i < 30; i++ {
+		charId1 := layout[i]
+		for j := 0; j < 30; j++ {
+			charId2 := layout[j]
+			score += bigrams[charId1][charId2] * bigramKeyWeights[i][j]
+		}
+	}
+	return score
+}
+
+func TestCalculateScoreMatchesSliceOfSlices(t *testing.T) {
+	mapping := kbdlayout.NewMapping(kbdlayout.Abcde)
+	sf := syntheticBigrams(t, mapping)
+	reference := newSliceOfSlicesBigrams(sf, len(mapping.ID2Rune))
+	for _, layout := range benchLayouts() {
+		if got, want := sf.CalculateScore(&layout), reference.CalculateScore(&layout); got != want {
+			t.Fatalf("score of %v is %d, want %d", layout, got, want)
+		}
+	}
+}
+
+func BenchmarkCalculateScore(b *testing.B) {
+	mapping := kbdlayout.NewMapping(kbdlayout.Abcde)
+	sf := syntheticBigrams(b, mapping)
+	layouts := benchLayouts()
+
+	var sum uint64
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sum += sf.CalculateScore(&layouts[i%len(layouts)])
+	}
+	if sum == 0 {
+		b.Fatal("every layout scored 0")
+	}
+}
+
+func BenchmarkCalculateScoreSliceOfSlices(b *testing.B) {
+	mapping := kbdlayout.NewMapping(kbdlayout.Abcde)
+	reference := newSliceOfSlicesBigrams(syntheticBigrams(b, mapping), len(mapping.ID2Rune))
+	layouts := benchLayouts()
+
+	var sum uint64
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sum += reference.CalculateScore(&layouts[i%len(layouts)])
+	}
+	if sum == 0 {
+		b.Fatal("every layout scored 0")
+	}
+}
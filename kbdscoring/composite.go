@@ -0,0 +1,83 @@
+package kbdscoring
+
+import "math"
+
+import "../kbdlayout"
+
+// Scoring function with floating point scores, which can be fractional
+// or negative, e.g. when penalties are subtracted. Higher score still
+// translates to better keyboard layout.
+type FloatScoringFunction interface {
+	Init(mapping *kbdlayout.KeyboardMapping)
+
+	CalculateFloatScore(layout *kbdlayout.KeyboardLayout) float64
+}
+
+const signBit = 1 << 63
+
+// Converts a float score to an integer score with the same order,
+// so that float scores can be used where a ScoringFunction is needed.
+//
+// The bits of positive floats are already in order as integers, they
+// only need to be placed above the negative ones. Negative floats are
+// in the reverse order, which is fixed by flipping all the bits.
+func FloatToScore(f float64) uint64 {
+	bits := math.Float64bits(f)
+	if bits&signBit == 0 {
+		return bits | signBit
+	}
+	return ^bits
+}
+
+// Returns the float score that was converted with FloatToScore
+func ScoreToFloat(score uint64) float64 {
+	if score&signBit != 0 {
+		return math.Float64frombits(score &^ signBit)
+	}
+	return math.Float64frombits(^score)
+}
+
+// One of the scoring functions of a composite
+type CompositeTerm struct {
+	Func   ScoringFunction
+	Weight float64 // negative weight makes the term a penalty
+}
+
+// Scores layouts by the weighted sum of the normalized scores of other
+// scoring functions. Implements both FloatScoringFunction and
+// ScoringFunction, so it can be used with the generator too.
+type CompositeScoringFunc struct {
+	Terms []CompositeTerm
+}
+
+func (s *CompositeScoringFunc) Init(mapping *kbdlayout.KeyboardMapping) {
+	for _, term := range s.Terms {
+		term.Func.Init(mapping)
+	}
+}
+
+func (s *CompositeScoringFunc) CalculateFloatScore(layout *kbdlayout.KeyboardLayout) float64 {
+	var score float64
+	for _, term := range s.Terms {
+		score += term.Weight * term.Func.NormalizeScore(term.Func.CalculateScore(layout))
+	}
+	return score
+}
+
+func (s *CompositeScoringFunc) CalculateScore(layout *kbdlayout.KeyboardLayout) uint64 {
+	return FloatToScore(s.CalculateFloatScore(layout))
+}
+
+// The float score is already normalized by the terms
+func (s *CompositeScoringFunc) NormalizeScore(score uint64) float64 {
+	return ScoreToFloat(score)
+}
+
+// Sets the baseline for all the terms that have one
+func (s *CompositeScoringFunc) SetBaseline(layout string) {
+	for _, term := range s.Terms {
+		if baseliner, ok := term.Func.(Baseliner); ok {
+			baseliner.SetBaseline(layout)
+		}
+	}
+}
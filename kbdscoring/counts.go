@@ -0,0 +1,24 @@
+package kbdscoring
+
+import "os"
+import "log"
+
+// Returns instructions for getting the counts file if it doesn't exist,
+// like how to count the corpus of a language, or an empty string. Set by
+// the program, the scoring functions only read their counts in Init, so
+// only the commands that score with them need the files.
+var MissingCountsHint = func(filename string) string {
+	return ""
+}
+
+// Opens the counts file, stops with the hint if it doesn't exist
+func openCounts(filename string) *os.File {
+	file, err := os.Open(filename)
+	if err != nil {
+		if hint := MissingCountsHint(filename); os.IsNotExist(err) && hint != "" {
+			log.Fatalf("%v\n%s", err, hint)
+		}
+		log.Fatal(err)
+	}
+	return file
+}
@@ -0,0 +1,92 @@
+package kbdscoring
+
+import "../kbdlayout"
+
+// Scoring functions that can score the characters on the extra keys of
+// kbdlayout.ExtraKeys too implement this, so that the characters that
+// don't fit on the 30 keys can be placed along with them
+type ExtraKeysScoringFunction interface {
+	ScoringFunction
+
+	// Score of the layout with extra[i] on the extra key i, on the
+	// scale of CalculateScore, which it equals without extra keys
+	CalculateExtraScore(layout *kbdlayout.KeyboardLayout, extra []uint8) uint64
+}
+
+// Returns the position 0..29 whose weights the position scores with,
+// and the share of the weights in quarters. The positions 0..29 are the
+// block, 30+i is the extra key i, which scores like its neighbour in the
+// last column, but less as the pinky has to reach further for it.
+func weightPosition(pos int) (int, uint64) {
+	if pos < 30 {
+		return pos, 4
+	}
+	key := kbdlayout.ExtraKeys[pos-30]
+	if key.Column == 10 {
+		return key.Neighbour(), 3
+	}
+	return key.Neighbour(), 2
+}
+
+// Returns the monogram weight of the position 0..29 or 30+i of the extra key i
+func extraMonogramWeight(pos int) uint64 {
+	weightPos, share := weightPosition(pos)
+	return monogramKeyWeights[weightPos] * share / 4
+}
+
+// Returns the bigram weight of the positions 0..29 or 30+i of the extra key i
+func extraBigramWeight(pos1, pos2 int) uint64 {
+	weightPos1, share1 := weightPosition(pos1)
+	weightPos2, share2 := weightPosition(pos2)
+	if weightPos1 == weightPos2 && pos1 != pos2 {
+		// different keys of the pinky on the same row, as slow
+		// as keys of the same finger on different rows
+		if weightPos2 == 19 {
+			weightPos2 = 9
+		} else {
+			weightPos2 = 19
+		}
+	}
+	if share2 < share1 {
+		share1 = share2
+	}
+	return bigramKeyWeights[weightPos1][weightPos2] * share1 / 4
+}
+
+func (s *MonogramScoringFunc) CalculateExtraScore(layout *kbdlayout.KeyboardLayout, extra []uint8) uint64 {
+	score := s.CalculateScore(layout)
+	for i, charId := range extra {
+		score += s.monograms[charId] * extraMonogramWeight(30+i)
+	}
+	return score
+}
+
+func (s *BigramScoringFunc) CalculateExtraScore(layout *kbdlayout.KeyboardLayout, extra []uint8) uint64 {
+	score := s.CalculateScore(layout)
+	for i, charId := range extra {
+		pos := 30 + i
+		for j := 0; j < 30; j++ {
+			score += s.bigrams[s.index(charId, layout[j])] * extraBigramWeight(pos, j)
+			score += s.bigrams[s.index(layout[j], charId)] * extraBigramWeight(j, pos)
+		}
+		for k, other := range extra {
+			score += s.bigrams[s.index(charId, other)] * extraBigramWeight(pos, 30+k)
+		}
+	}
+	return score
+}
+
+// Terms that can't score the extra keys score the 30 keys only
+func (s *CompositeScoringFunc) CalculateExtraScore(layout *kbdlayout.KeyboardLayout, extra []uint8) uint64 {
+	var score float64
+	for _, term := range s.Terms {
+		var termScore uint64
+		if extraKeys, ok := term.Func.(ExtraKeysScoringFunction); ok {
+			termScore = extraKeys.CalculateExtraScore(layout, extra)
+		} else {
+			termScore = term.Func.CalculateScore(layout)
+		}
+		score += term.Weight * term.Func.NormalizeScore(termScore)
+	}
+	return FloatToScore(score)
+}
@@ -0,0 +1,61 @@
+package kbdscoring
+
+import "testing"
+
+import "../kbdlayout"
+
+func TestExtraWeightsOfLayout(t *testing.T) {
+	prepareWeights()
+	for i := 0; i < 30; i++ {
+		if extraMonogramWeight(i) != monogramKeyWeights[i] {
+			t.Errorf("monogram weight of position %d is %d, want %d", i, extraMonogramWeight(i), monogramKeyWeights[i])
+		}
+		for j := 0; j < 30; j++ {
+			if extraBigramWeight(i, j) != bigramKeyWeights[i][j] {
+				t.Errorf("bigram weight of positions %d and %d is %d, want %d", i, j, extraBigramWeight(i, j), bigramKeyWeights[i][j])
+			}
+		}
+	}
+}
+
+func TestExtraKeysWeighLessThanTheirNeighbours(t *testing.T) {
+	prepareWeights()
+	for i, key := range kbdlayout.ExtraKeys {
+		pos, neighbour := 30+i, key.Neighbour()
+		if extraMonogramWeight(pos) > extraMonogramWeight(neighbour) {
+			t.Errorf("extra key %s weighs %d, more than its neighbour %d", key, extraMonogramWeight(pos), extraMonogramWeight(neighbour))
+		}
+		for other := 0; other < 30+len(kbdlayout.ExtraKeys); other++ {
+			if other == pos || other == neighbour {
+				continue
+			}
+			if extraBigramWeight(pos, other) > extraBigramWeight(neighbour, other) {
+				t.Errorf("extra key %s weighs %d with %d, more than its neighbour %d", key, extraBigramWeight(pos, other), other, extraBigramWeight(neighbour, other))
+			}
+		}
+	}
+}
+
+func TestCalculateExtraScore(t *testing.T) {
+	characters := kbdlayout.Abcde + "åäöü"
+	mapping := kbdlayout.NewMapping(characters)
+	sf := syntheticBigrams(t, mapping)
+	layout := kbdlayout.NewLayout(kbdlayout.Abcde, mapping)
+
+	if score := sf.CalculateExtraScore(&layout, nil); score != sf.CalculateScore(&layout) {
+		t.Errorf("score without extra keys is %d, want %d", score, sf.CalculateScore(&layout))
+	}
+
+	// every pair of the 34 positions scored with the weights
+	extra := []uint8{30, 31, 32, 33}
+	placed := append(layout[:], extra...)
+	var want uint64
+	for i, charId1 := range placed {
+		for j, charId2 := range placed {
+			want += sf.bigrams[sf.index(charId1, charId2)] * extraBigramWeight(i, j)
+		}
+	}
+	if score := sf.CalculateExtraScore(&layout, extra); score != want {
+		t.Errorf("score with extra keys is %d, want %d", score, want)
+	}
+}
@@ -20,3 +20,18 @@ type ScoringFunction interface {
 	// will be presented to user.
 	NormalizeScore(score uint64) float64
 }
+
+// Scoring functions whose score is a sum of scores of the keys and
+// the pairs of keys implement this too, so that layouts can be scored
+// before all the keys are placed. The score of a layout is the sum of
+// KeyScore of each key and PairScore of each pair of different keys.
+type PairwiseScoringFunction interface {
+	ScoringFunction
+
+	// Score of the character on the position by itself
+	KeyScore(pos int, charId uint8) uint64
+
+	// Score of the characters on two different positions together,
+	// the same whichever way round they are given
+	PairScore(pos1 int, charId1 uint8, pos2 int, charId2 uint8) uint64
+}
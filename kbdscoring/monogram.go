@@ -1,16 +1,16 @@
 package kbdscoring
 
-import "os"
 import "log"
-import "unicode"
 import "unicode/utf8"
 import "strconv"
 import "bufio"
 import "../kbdlayout"
 
 type MonogramScoringFunc struct {
-	monograms   []uint64 // monograms[mapping.Rune2ID['e']] = 5234
-	qwertyScore uint64   // will be used for normalizing
+	File string // monogram counts, monograms.txt if empty
+
+	monograms  []uint64 // monograms[mapping.Rune2ID['e']] = 5234
+	Normalizer          // the baseline is qwerty unless set otherwise
 }
 
 // Weights for each key location in layout
@@ -23,10 +23,12 @@ var monogramKeyWeights = [30]uint64{
 
 // Loads monograms from file and stores character counts with indices
 func (s *MonogramScoringFunc) Init(mapping *kbdlayout.KeyboardMapping) {
-	file, err := os.Open("monograms.txt")
-	if err != nil {
-		log.Fatal(err)
+	filename := s.File
+	if filename == "" {
+		filename = "monograms.txt"
 	}
+	file := openCounts(filename)
+	defer file.Close()
 	scanner := bufio.NewScanner(file)
 
 	s.monograms = make([]uint64, len(mapping.ID2Rune))
@@ -39,7 +41,7 @@ func (s *MonogramScoringFunc) Init(mapping *kbdlayout.KeyboardMapping) {
 		line = line[size+1:]
 
 		// make letter lowercase
-		letter = unicode.ToLower(letter)
+		letter = mapping.ToLower(letter)
 
 		characterId, ok := mapping.Rune2ID[letter]
 		if !ok {
@@ -53,12 +55,21 @@ func (s *MonogramScoringFunc) Init(mapping *kbdlayout.KeyboardMapping) {
 			// invalid format for the monograms file
 			log.Fatal(err)
 		}
-		s.monograms[characterId] = count
+		// characters folded to the same one add up
+		s.monograms[characterId] += count
+	}
+
+	// make sure the score fits in uint64 even with huge corpora
+	var maxWeight uint64
+	for _, weight := range monogramKeyWeights {
+		if weight > maxWeight {
+			maxWeight = weight
+		}
 	}
+	scaleCounts(filename, s.monograms, maxWeight)
 
-	// calculate the score for qwerty layout, so we can use it as a base.
-	qwerty := kbdlayout.NewLayout(kbdlayout.Qwerty, mapping)
-	s.qwertyScore = s.CalculateScore(&qwerty)
+	// calculate the score for the baseline layout, so we can use it as a base.
+	s.initBaseline(mapping, s.CalculateScore)
 }
 
 // Loop through the layout
@@ -80,7 +91,11 @@ func (s *MonogramScoringFunc) CalculateScore(layout *kbdlayout.KeyboardLayout) u
 	return score
 }
 
-// Normalize score so that qwerty is 1.0
-func (s *MonogramScoringFunc) NormalizeScore(score uint64) float64 {
-	return float64(score) / float64(s.qwertyScore)
+func (s *MonogramScoringFunc) KeyScore(pos int, charId uint8) uint64 {
+	return s.monograms[charId] * monogramKeyWeights[pos]
+}
+
+// Characters are scored alone, so pairs don't add to the score
+func (s *MonogramScoringFunc) PairScore(pos1 int, charId1 uint8, pos2 int, charId2 uint8) uint64 {
+	return 0
 }
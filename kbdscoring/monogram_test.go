@@ -0,0 +1,35 @@
+package kbdscoring
+
+import "os"
+import "testing"
+import "path/filepath"
+
+import "../kbdlayout"
+
+func TestMonogramsFoldedByLocale(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "monograms.txt")
+	if err := os.WriteFile(filename, []byte("e 100\nê 20\nÊ 3\nç 5\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		locale     string
+		characters string
+		e, ç       uint64
+	}{
+		// French types ê with the key of e
+		{"fr", kbdlayout.Abcde + "ç", 123, 5},
+		// but not if the mapping has a key for it
+		{"fr", kbdlayout.Abcde + "çê", 100, 5},
+		// and English doesn't fold it
+		{"en", kbdlayout.Abcde + "ç", 100, 5},
+	}
+	for _, test := range tests {
+		mapping := kbdlayout.NewLocaleMapping(test.characters, test.locale)
+		sf := &MonogramScoringFunc{File: filename}
+		sf.Init(mapping)
+		if e, ç := sf.monograms[mapping.Rune2ID['e']], sf.monograms[mapping.Rune2ID['ç']]; e != test.e || ç != test.ç {
+			t.Errorf("%s with %q: e counts %d and ç %d, want %d and %d", test.locale, test.characters, e, ç, test.e, test.ç)
+		}
+	}
+}
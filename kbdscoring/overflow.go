@@ -0,0 +1,37 @@
+package kbdscoring
+
+import "log"
+import "math"
+
+// Returns the divisor for the counts that keeps a score from overflowing
+// uint64, even if every count was multiplied by maxWeight. Returns 1 when
+// the counts can be used as they are.
+func countScale(counts []uint64, maxWeight uint64) uint64 {
+	// float64 won't overflow with the sum, but it is not exact,
+	// so leave some room below the real limit
+	const limit = math.MaxUint64 / 2
+
+	var total float64
+	for _, count := range counts {
+		total += float64(count)
+	}
+
+	bound := total * float64(maxWeight)
+	if bound < limit {
+		return 1
+	}
+	return uint64(math.Ceil(bound / limit))
+}
+
+// Divides the counts so that scores calculated from them with
+// weights up to maxWeight can't overflow. Returns the divisor.
+func scaleCounts(name string, counts []uint64, maxWeight uint64) uint64 {
+	scale := countScale(counts, maxWeight)
+	if scale > 1 {
+		log.Printf("%s: counts are too large for the scores, dividing them by %d", name, scale)
+		for i := range counts {
+			counts[i] /= scale
+		}
+	}
+	return scale
+}
@@ -0,0 +1,110 @@
+package kbdscoring
+
+import "log"
+
+import "../kbdlayout"
+
+// Scores layouts by how close they are to a reference layout, so
+// that switching to them is easier to learn. Each character scores
+// the most when it stays in its place, less when it stays on the
+// same finger or the same hand, and nothing when it changes hands.
+type SimilarityScoringFunc struct {
+	Reference string // layout to compare to, qwerty if empty
+	Weighted  bool   // weight characters by their frequency in the monograms
+	Monograms string // monogram counts for weighting, monograms.txt if empty
+
+	positions []int    // positions[mapping.Rune2ID['e']] = 2 on the reference, -1 if not on it
+	weights   []uint64 // weights[mapping.Rune2ID['e']] = 5234
+	maxScore  uint64   // score of the reference itself, will be used for normalizing
+}
+
+// score of a character for staying in the same place,
+// on the same finger or on the same hand
+const (
+	samePositionScore = 4
+	sameFingerScore   = 2
+	sameHandScore     = 1
+)
+
+func (s *SimilarityScoringFunc) Init(mapping *kbdlayout.KeyboardMapping) {
+	reference := s.Reference
+	if reference == "" {
+		reference = kbdlayout.Qwerty
+	}
+
+	// like the baseline of the Normalizer, a reference the mapping
+	// doesn't have the characters for is replaced with the mapping order
+	s.positions = make([]int, len(mapping.ID2Rune))
+	for i := range s.positions {
+		s.positions[i] = -1
+	}
+	layout, err := kbdlayout.ParseLayout(reference, mapping)
+	if err != nil {
+		if len(mapping.ID2Rune) < 30 {
+			log.Printf("can't use reference '%s' (%v), every character will score 0", reference, err)
+			return
+		}
+		log.Printf("can't use reference '%s' (%v), using characters in the mapping order instead", reference, err)
+		for i := 0; i < 30; i++ {
+			layout[i] = uint8(i)
+		}
+	}
+	for i := 0; i < 30; i++ {
+		s.positions[layout[i]] = i
+	}
+
+	s.weights = make([]uint64, len(mapping.ID2Rune))
+	if s.Weighted {
+		// reuse the monogram counts
+		monogram := &MonogramScoringFunc{File: s.Monograms}
+		monogram.Init(mapping)
+		copy(s.weights, monogram.monograms)
+	} else {
+		for i := range s.weights {
+			s.weights[i] = 1
+		}
+	}
+
+	s.maxScore = s.CalculateScore(&layout)
+}
+
+func (s *SimilarityScoringFunc) CalculateScore(layout *kbdlayout.KeyboardLayout) uint64 {
+
+	var score uint64
+
+	for i := 0; i < 30; i++ {
+		score += s.KeyScore(i, layout[i])
+	}
+
+	return score
+}
+
+// Score of the character for where it is compared to the reference
+func (s *SimilarityScoringFunc) KeyScore(pos int, charId uint8) uint64 {
+	original := s.positions[charId]
+
+	switch {
+	case original < 0:
+		return 0
+	case original == pos:
+		return s.weights[charId] * samePositionScore
+	case kbdlayout.FingerOf(original) == kbdlayout.FingerOf(pos):
+		return s.weights[charId] * sameFingerScore
+	case kbdlayout.FingerOf(original).Hand() == kbdlayout.FingerOf(pos).Hand():
+		return s.weights[charId] * sameHandScore
+	}
+	return 0
+}
+
+// Characters are scored alone, so pairs don't add to the score
+func (s *SimilarityScoringFunc) PairScore(pos1 int, charId1 uint8, pos2 int, charId2 uint8) uint64 {
+	return 0
+}
+
+// Normalize score so that the reference is 1.0
+func (s *SimilarityScoringFunc) NormalizeScore(score uint64) float64 {
+	if s.maxScore == 0 {
+		return float64(score)
+	}
+	return float64(score) / float64(s.maxScore)
+}
@@ -0,0 +1,93 @@
+package main
+
+import "os"
+import "fmt"
+import "log"
+import "flag"
+import "strings"
+import "unicode/utf8"
+
+import "./kbdlayout"
+
+// directory of the layout files shipped with kbdgen,
+// relative to the working directory like the corpus files
+const defaultLayoutDir = "layouts"
+
+// known layouts, the built-in ones until loadLibrary is called
+var library = kbdlayout.NewLibrary()
+
+// Loads the layouts from the default directory, if there is one,
+// and then from the given comma separated directories
+func loadLibrary(dirs string) {
+	if err := library.LoadDir(defaultLayoutDir); err != nil && !os.IsNotExist(err) {
+		log.Fatal(err)
+	}
+	if dirs == "" {
+		return
+	}
+	for _, dir := range strings.Split(dirs, ",") {
+		if err := library.LoadDir(dir); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// Finds the characters of a layout by its name, or returns
+// the name itself if it is a custom layout of 30 characters
+func findLayoutString(name string) string {
+	info, ok := library.Lookup(name)
+	if ok {
+		return info.Base()
+	}
+	if utf8.RuneCountInString(name) != 30 {
+		log.Fatalf("could not find layout '%s' %d\n", name, len(name))
+	}
+	return name
+}
+
+// Finds a layout by its name, or creates a custom one from 30 characters
+func findLayout(name string, mapping *kbdlayout.KeyboardMapping) kbdlayout.KeyboardLayout {
+	return kbdlayout.NewLayout(findLayoutString(name), mapping)
+}
+
+// kbdgen list
+//
+// Lists the known layouts
+func listCommand(args []string) {
+	flags := flag.NewFlagSet("list", flag.ExitOnError)
+	var verboseParam = flags.Bool("v", false, "show all the details and layers of the layouts")
+	common := addCommonFlags(flags)
+	flags.Parse(args)
+	common.applyLibrary()
+
+	for _, name := range library.Names() {
+		info, _ := library.Lookup(name)
+
+		var details []string
+		if info.Author != "" {
+			details = append(details, info.Author)
+		}
+		if info.Year != 0 {
+			details = append(details, fmt.Sprint(info.Year))
+		}
+		if info.Language != "" {
+			details = append(details, info.Language)
+		}
+
+		title := info.Title
+		if title == "" {
+			title = name
+		}
+		fmt.Printf("%-12s %s  %-28s %s\n", name, info.Base(), title, strings.Join(details, ", "))
+
+		if *verboseParam {
+			if info.File != "" {
+				fmt.Printf("%12s file: %s\n", "", info.File)
+			}
+			fmt.Printf("%12s geometry: %s\n", "", info.Geometry)
+			for i, layer := range info.Layers {
+				fmt.Printf("%12s layer %d: %s\n", "", i+1, layer)
+			}
+		}
+	}
+}
@@ -1,72 +1,125 @@
 package main
 
 import "fmt"
+import "strings"
 import "os"
 import "unicode/utf8"
 import "os/signal"
 import "log"
 import "flag"
 import "time"
-import "math/rand"
-import "runtime"
+import "context"
 
 import "./kbdscoring"
 import "./kbdlayout"
 import "./gen"
 
-var scoringFuncs = map[string]kbdscoring.ScoringFunction{
-	"monogram": &kbdscoring.MonogramScoringFunc{},
-	"bigram":   &kbdscoring.BigramScoringFunc{},
-}
-
-var defaultMapping = kbdlayout.NewMapping("abcdefghijklmnopqrstuvwxyz.,;/")
-
-var layouts = map[string]kbdlayout.KeyboardLayout{
-	"qwerty":  kbdlayout.NewLayout(kbdlayout.Qwerty, defaultMapping),
-	"abcde":   kbdlayout.NewLayout(kbdlayout.Abcde, defaultMapping),
-	"dvorak":  kbdlayout.NewLayout(kbdlayout.Dvorak, defaultMapping),
-	"colemak": kbdlayout.NewLayout(kbdlayout.Colemak, defaultMapping),
-	"asset":   kbdlayout.NewLayout(kbdlayout.Asset, defaultMapping),
-	"workman": kbdlayout.NewLayout(kbdlayout.Workman, defaultMapping),
-	"nail":    kbdlayout.NewLayout(kbdlayout.Nail, defaultMapping),
-	"layman":  kbdlayout.NewLayout(kbdlayout.Layman, defaultMapping),
+// commands other than scoring and generating, given as the first argument
+var commands = map[string]func(args []string){
+	"bench":    benchCommand,
+	"corpus":   corpusCommand,
+	"diff":     diffCommand,
+	"edit":     editCommand,
+	"explain":  explainCommand,
+	"list":     listCommand,
+	"optimize": optimizeCommand,
+	"polish":   polishCommand,
+	"serve":    serveCommand,
+	"simulate": simulateCommand,
 }
 
 func main() {
 
-	var genCharactersParam = flag.String("characters", "abcdefghijklmnopqrstuvwxyz.,/;", "30 characters to use in the generator")
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			command(os.Args[2:])
+			return
+		}
+	}
+
+	var genCharactersParam = flag.String("characters", "", "30 characters to use in the generator, the ones of the language preset if empty; the other characters of the preset go on the extra keys")
 	var scoringFuncParam = flag.String("scoring-func", "monogram", "which function to use")
-	var layoutParam = flag.String("layout", "", "all/qwerty/dvorak/colemak/asset/workman/nail/layman or custom (define with 30 characters)")
+	var layoutParam = flag.String("layout", "", "all, name of a layout (see kbdgen list) or custom (define with 30 characters)")
+	var rawParam = flag.Bool("raw", false, "show the raw scores too, not only the normalized ones")
+	var polishParam = flag.Bool("polish", false, "polish each new best and the hall of fame with hill climbing")
+	var cyclesParam = flag.Bool("cycles", false, "try rotations of three keys too when polishing")
+	var referenceParam = flag.String("reference", "", "layout to compare to with the similarity scoring func and max-moved-keys, the baseline of the language preset if empty")
+	var maxMovedKeysParam = flag.Int("max-moved-keys", -1, "generate only layouts with at most this many keys moved from the reference, -1 for no limit")
+	var tuiParam = flag.Bool("tui", false, "show the progress of the generator in a terminal UI, with keys to pause, pin keys, save and stop")
+	var tuiSaveParam = flag.String("tui-save", "kbdgen-saved.txt", "file the terminal UI appends the saved layouts to")
+	var statsParam = flag.Bool("stats", false, "print how many layouts each worker scored and where the time went at exit")
+	var debugAddrParam = flag.String("debug-addr", "", "address to serve the stats of the workers with expvar and profiles with pprof on, e.g. localhost:6060")
+	common := addCommonFlags(flag.CommandLine)
+
+	// stopping criteria for the generator
+	var stop stopCriteria
+	flag.DurationVar(&stop.maxTime, "max-time", 0, "stop the generator after this long (e.g. 10m), 0 to run until interrupted")
+	flag.Uint64Var(&stop.maxGenerations, "max-generations", 0, "stop the generator after this many generations over all workers, 0 for no limit")
+	flag.Float64Var(&stop.targetScore, "target-score", 0, "stop the generator when the normalized score reaches this, 0 for no target")
+	flag.Uint64Var(&stop.stagnation, "stagnation", 0, "stop the generator after this many generations without improvement, 0 for no limit")
+
+	var hallOfFameParam = flag.Int("hall-of-fame", 0, "keep this many best distinct layouts and print them at exit")
+	var hofMinDistanceParam = flag.Int("hof-min-distance", 1, "minimum number of swaps between layouts in the hall of fame")
+	var hofExportParam = flag.String("hof-export", "", "file to write the hall of fame layouts to at exit")
+
+	var configParam = flag.String("config", "", "JSON file with generator options, options given on command line override it")
+
+	// generator options
+	opts := gen.DefaultOptions()
+	flag.IntVar(&opts.PopulationSize, "population-size", opts.PopulationSize, "number of layouts in each population")
+	flag.IntVar(&opts.Parents, "parents", opts.Parents, "number of best layouts mixed to create the next generation")
+	flag.IntVar(&opts.RandomizeMin, "randomize-min", opts.RandomizeMin, "number of layouts randomized on each generation")
+	flag.IntVar(&opts.RandomizeStep, "randomize-step", opts.RandomizeStep, "growth of randomized layouts on each generation while the population is below min-diversity")
+	flag.IntVar(&opts.RandomizeMax, "randomize-max", opts.RandomizeMax, "maximum number of randomized layouts when the population has fully converged")
+	flag.Float64Var(&opts.MinDiversity, "min-diversity", opts.MinDiversity, "diversity of the parents, from 0 to 1, below which randomization and mutation are increased")
+	flag.StringVar(&opts.Crossover, "crossover", opts.Crossover, fmt.Sprintf("how parents are mixed: %s", strings.Join(gen.CrossoverNames(), "/")))
+	flag.IntVar(&opts.MutationFactor, "mutation-factor", opts.MutationFactor, "layouts get up to (factor-1)^2 random swaps on each generation, up to double the factor while below min-diversity")
+	flag.IntVar(&opts.Workers, "workers", opts.Workers, "number of populations evolving in parallel")
+	flag.IntVar(&opts.MaxProcs, "max-procs", opts.MaxProcs, "maximum number of threads to run the workers on")
+	flag.StringVar(&opts.Topology, "topology", opts.Topology, "how the populations exchange migrants: none/ring/full")
+	flag.Uint64Var(&opts.MigrationInterval, "migration-interval", opts.MigrationInterval, "generations between migrations")
+	flag.IntVar(&opts.Migrants, "migrants", opts.Migrants, "number of layouts sent to each neighbouring population on migration")
+	flag.StringVar(&opts.Optimizer, "optimizer", opts.Optimizer, fmt.Sprintf("how the workers search layouts: %s", strings.Join(gen.OptimizerNames(), "/")))
+	flag.IntVar(&opts.TabuTenure, "tabu-tenure", opts.TabuTenure, "generations a swapped pair of keys can't be swapped again in tabu search")
+	flag.Uint64Var(&opts.TabuRestart, "tabu-restart", opts.TabuRestart, "generations without improvement before tabu search starts over, 0 for never")
+	flag.Int64Var(&opts.Seed, "seed", opts.Seed, "seed of the random numbers to repeat a run with -workers 1, 0 for a different run each time")
 
 	flag.Parse()
 
+	if *configParam != "" {
+		if err := loadConfig(*configParam, &opts); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	common.apply()
+	if *referenceParam == "" {
+		*referenceParam = activePreset.baseline
+	}
+	similarityScoringFunc.Reference = findLayoutString(*referenceParam)
+	if *genCharactersParam == "" {
+		*genCharactersParam = activePreset.characters
+	}
+
 	sf, ok := scoringFuncs[*scoringFuncParam]
 	if !ok {
 		fmt.Printf("could not find scoring func '%s'", *scoringFuncParam)
 		return
 	}
 	if *layoutParam != "" {
-		// scoring can happen on default mapping
-		// TODO: will not work on all cases
-		sf.Init(defaultMapping)
+		// scoring happens on the given characters, which
+		// need to have all the characters of the layouts
+		mapping := kbdlayout.NewLocaleMapping(*genCharactersParam, activePreset.locale)
+		sf.Init(mapping)
 
 		if *layoutParam == "all" {
 			// calculate scores for all layouts
-			scoreAll(sf)
+			scoreAll(sf, mapping, *rawParam)
 			return
 		}
 
 		// only calculate score for given layout
-		layout, ok := layouts[*layoutParam]
-		if !ok {
-			if utf8.RuneCountInString(*layoutParam) == 30 {
-				layout = kbdlayout.NewLayout(*layoutParam, defaultMapping)
-			} else {
-				log.Fatalf("could not find layout '%s' %d\n", *layoutParam, len(*layoutParam))
-			}
-		}
-
-		scoreOne(sf, layout)
+		scoreOne(sf, mapping, findLayout(*layoutParam, mapping), *rawParam)
 		return
 	}
 
@@ -76,83 +129,258 @@ func main() {
 		log.Fatalf("the generator needs exactly 30 characters, got %d", utf8.RuneCountInString(*genCharactersParam))
 	}
 
-	mapping := kbdlayout.NewMapping(*genCharactersParam)
+	if err := opts.Validate(); err != nil {
+		log.Fatalf("invalid generator options: %v", err)
+	}
+
+	// the characters of the preset that are not generated go on the extra keys
+	mapping := kbdlayout.NewLocaleMapping(*genCharactersParam+presetExtra(*genCharactersParam), activePreset.locale)
 	sf.Init(mapping)
 
+	if *maxMovedKeysParam >= 0 {
+		opts.Constraints = append(opts.Constraints, &gen.MaxMovedKeys{
+			Reference: findLayout(*referenceParam, mapping),
+			Max:       *maxMovedKeysParam,
+		})
+	}
+
+	if *statsParam || *debugAddrParam != "" {
+		opts.Stats = gen.NewStats(opts.Workers)
+	}
+	if *debugAddrParam != "" {
+		serveDebug(*debugAddrParam, func() interface{} { return opts.Stats.Workers() })
+	}
+
+	var pins *gen.Pins
+	if *tuiParam {
+		pins = gen.NewPins()
+		opts.Constraints = append(opts.Constraints, pins)
+	}
+
+	extras := newExtraKeys(sf, *scoringFuncParam, mapping, opts.Constraints)
+
 	// start generating layouts
-	generateLayouts(sf, mapping)
+	hallOfFame := gen.NewHallOfFame(*hallOfFameParam, *hofMinDistanceParam)
+	var polish *polishing
+	if *polishParam {
+		polish = &polishing{cycles: *cyclesParam, constraints: opts.Constraints}
+	}
+	if *tuiParam {
+		generateLayoutsTUI(sf, mapping, &opts, &stop, polish, hallOfFame, pins, *referenceParam, *tuiSaveParam)
+	} else {
+		generateLayouts(sf, mapping, &opts, &stop, polish, hallOfFame, extras)
+	}
+	if *statsParam {
+		printStats(opts.Stats)
+	}
+	if polish != nil {
+		hallOfFame = polish.hallOfFame(sf, hallOfFame, *hallOfFameParam, *hofMinDistanceParam)
+	}
+
+	printHallOfFame(sf, mapping, hallOfFame, extras)
+
+	if *hofExportParam != "" {
+		if err := exportHallOfFame(*hofExportParam, sf, mapping, hallOfFame, extras); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// Loads the generator options from the config file, while keeping
+// the ones given on the command line
+func loadConfig(filename string, opts *gen.Options) error {
+	// flags are bound to the options, so remember what was given
+	// before the config file overwrites them
+	given := map[string]string{}
+	flag.Visit(func(f *flag.Flag) {
+		given[f.Name] = f.Value.String()
+	})
+
+	if err := opts.Load(filename); err != nil {
+		return err
+	}
+
+	for name, value := range given {
+		if err := flag.Set(name, value); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func scoreAll(sf kbdscoring.ScoringFunction) {
-	for name, layout := range layouts {
-		fmt.Printf("%16.12f - %s\n", sf.NormalizeScore(sf.CalculateScore(&layout)), name)
+func scoreAll(sf kbdscoring.ScoringFunction, mapping *kbdlayout.KeyboardMapping, raw bool) {
+	for _, name := range library.Names() {
+		info, _ := library.Lookup(name)
+		layout, err := kbdlayout.ParseLayout(info.Base(), mapping)
+		if err != nil {
+			fmt.Printf("%16s - %s (%v)\n", "skipped", name, err)
+			continue
+		}
+		fmt.Printf("%s - %s\n", formatScore(sf, sf.CalculateScore(&layout), raw), name)
 	}
 }
 
-func scoreOne(sf kbdscoring.ScoringFunction, layout kbdlayout.KeyboardLayout) {
-	score := sf.NormalizeScore(sf.CalculateScore(&layout))
+func scoreOne(sf kbdscoring.ScoringFunction, mapping *kbdlayout.KeyboardMapping, layout kbdlayout.KeyboardLayout, raw bool) {
+	score := sf.CalculateScore(&layout)
 	fmt.Println("----")
-	defaultMapping.PrintLayout(&layout)
+	mapping.PrintLayout(&layout)
+	printExtraKeys()
 	fmt.Println("----")
-	fmt.Printf("%16.12f\n", score)
+	fmt.Println(formatScore(sf, score, raw))
 }
 
-func generateLayouts(sf kbdscoring.ScoringFunction, mapping *kbdlayout.KeyboardMapping) {
+// Formats the normalized score, followed by the raw score if asked for
+func formatScore(sf kbdscoring.ScoringFunction, score uint64, raw bool) string {
+	if raw {
+		return fmt.Sprintf("%16.12f %20d", sf.NormalizeScore(score), score)
+	}
+	return fmt.Sprintf("%16.12f", sf.NormalizeScore(score))
+}
 
-	// we'll start an unending process, so lets hook up to a interrupt and kill signals
+// Criteria for stopping the generator, zero values disable them
+type stopCriteria struct {
+	maxTime        time.Duration
+	maxGenerations uint64
+	targetScore    float64
+	stagnation     uint64
+}
+
+// Tells why the generator should stop at the given generation,
+// or returns an empty string if it should go on
+func (c *stopCriteria) reason(sf kbdscoring.ScoringFunction, best *gen.LayoutEntry, generation, lastImprovement uint64) string {
+	if c.maxGenerations > 0 && generation >= c.maxGenerations {
+		return fmt.Sprintf("reached %d generations", c.maxGenerations)
+	}
+	if c.targetScore > 0 && best != nil && sf.NormalizeScore(best.Score) >= c.targetScore {
+		return fmt.Sprintf("reached target score %f", c.targetScore)
+	}
+	if c.stagnation > 0 && generation-lastImprovement >= c.stagnation {
+		return fmt.Sprintf("no improvement in %d generations", c.stagnation)
+	}
+	return ""
+}
+
+func generateLayouts(sf kbdscoring.ScoringFunction, mapping *kbdlayout.KeyboardMapping, opts *gen.Options, stop *stopCriteria, polish *polishing, hallOfFame *gen.HallOfFame, extras *extraKeys) {
+
+	// the workers run until the context is done
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// the time limit
+	if stop.maxTime > 0 {
+		ctx, cancel = context.WithTimeout(ctx, stop.maxTime)
+		defer cancel()
+	}
+
+	// we'll start a possibly unending process, so lets hook up to a interrupt and kill signals
 	//
 	// buffer size of at least 1 is necessary, so we don't miss the signal in case we're not
 	// listening it while it fires
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, os.Interrupt, os.Kill)
+	defer signal.Stop(quit)
+	go func() {
+		select {
+		case sig := <-quit:
+			fmt.Printf("got signal: %s\n", sig.String())
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
 
-	// this is simple signaling channel
-	done := make(chan struct{})
-	// when this method exits, we're closing the done-channel to let everyone know
-	// that we're exiting
-	defer close(done)
+	// the best is polished in the background, so the workers don't wait
+	// for it, and it is the best unless the workers beat it meanwhile
+	var lastImprovement uint64
+	var best *gen.LayoutEntry
+	background := newBackgroundPolish(polish, sf)
+	polishDone := func(polished *gen.LayoutEntry) {
+		if polished.Score > best.Score {
+			best = polished
+			hallOfFame.Add(polished)
+			fmt.Printf("polished: %16.12f\n", sf.NormalizeScore(polished.Score))
+			mapping.PrintLayout(&polished.Layout)
+		}
+		background.finished(polished, best)
+	}
 
-	// goroutines will send best of each generation via this channel
-	// make the buffer size 10 so no goroutine will need to pend writing
-	generationBest := make(chan *gen.LayoutEntry, 10)
+	var generations uint64
+	_, err := gen.Run(ctx, sf, opts, func(next *gen.LayoutEntry, generation uint64, improved bool) bool {
+		generations = generation
+		select {
+		case polished := <-background.done:
+			polishDone(polished)
+		default:
+		}
 
-	// setup the maximum number of threads
-	runtime.GOMAXPROCS(8)
-	// setup random
-	rand.Seed(time.Now().UnixNano())
+		// some goroutine got one generation evolved
+		hallOfFame.Add(next)
+		if generation%100 == 0 {
+			fmt.Printf(".")
+		}
+		// improved tells if it beats the best of the workers,
+		// which may be behind the polished best
+		if best == nil || next.Score > best.Score {
+			// got a new best
+			best = next
+			lastImprovement = generation
+			fmt.Printf("\nnew best: %16.12f at generation %d", sf.NormalizeScore(next.Score), generation)
+			if opts.Optimizer == "genetic" {
+				fmt.Printf(" (diversity %.3f)", next.Diversity)
+			}
+			fmt.Println()
+			mapping.PrintLayout(&next.Layout)
+			background.start(next)
+		}
+		if reason := stop.reason(sf, best, generation, lastImprovement); reason != "" {
+			fmt.Printf("\nstopping: %s\n", reason)
+			return true
+		}
+		return false
+	})
+	switch {
+	case err == context.DeadlineExceeded:
+		fmt.Printf("\nstopping: reached time limit %s\n", stop.maxTime)
+	case err != nil && err != context.Canceled:
+		log.Fatal(err)
+	}
 
-	// create 10 goroutines to evolve
-	for i := 0; i < 10; i++ {
-		go gen.EvolvePopulation(sf, generationBest, done)
+	// the polishing of the last best can still be running
+	for background.running {
+		polishDone(<-background.done)
 	}
 
-	// keep count of generations
-	var generation uint64
+	// print the final best, whatever the reason for stopping
+	if best != nil {
+		fmt.Printf("\nfinal best: %16.12f after %d generations\n", sf.NormalizeScore(best.Score), generations)
+		mapping.PrintLayout(&best.Layout)
+		extras.print(sf, mapping, best)
+	}
+}
 
-	// keep the best
-	var bestOfTheBest *gen.LayoutEntry = nil
+func printHallOfFame(sf kbdscoring.ScoringFunction, mapping *kbdlayout.KeyboardMapping, hallOfFame *gen.HallOfFame, extras *extraKeys) {
+	for i, entry := range hallOfFame.Entries() {
+		fmt.Printf("\n#%d: %16.12f\n", i+1, sf.NormalizeScore(entry.Score))
+		mapping.PrintLayout(&entry.Layout)
+		extras.print(sf, mapping, &entry)
+	}
+}
 
-	// loop forever
-	for {
-		select {
-		case sig := <-quit:
-			// the quit channel signaled
-			fmt.Printf("got signal: %s\n", sig.String())
-			// just return from the function
-			// this will trigger the close for the done channel
-			return
-		case next := <-generationBest:
-			// some goroutine got one generation evolved
-			generation++
-			if generation%100 == 0 {
-				fmt.Printf(".")
-			}
-			if bestOfTheBest == nil || bestOfTheBest.Score < next.Score {
-				// got a new best
-				bestOfTheBest = next
-				fmt.Printf("\nnew best: %16.12f at generation %d\n", sf.NormalizeScore(next.Score), generation)
-				mapping.PrintLayout(&next.Layout)
-			}
+// Writes the hall of fame layouts to the file, one per line
+// with the score and the layout string usable with -layout. With
+// extra keys, the layouts have the extra characters placed, which
+// follow the layout string in the order of kbdlayout.ExtraKeys.
+func exportHallOfFame(filename string, sf kbdscoring.ScoringFunction, mapping *kbdlayout.KeyboardMapping, hallOfFame *gen.HallOfFame, extras *extraKeys) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	for _, entry := range hallOfFame.Entries() {
+		if extras == nil {
+			fmt.Fprintf(file, "%.12f %s\n", sf.NormalizeScore(entry.Score), mapping.LayoutString(&entry.Layout))
+			continue
 		}
+		extra := extras.place(&entry)
+		fmt.Fprintf(file, "%.12f %s %s\n", sf.NormalizeScore(entry.Score), mapping.LayoutString(&entry.Layout), extraString(mapping, extra))
 	}
+	return file.Close()
 }
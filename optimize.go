@@ -0,0 +1,190 @@
+package main
+
+import "fmt"
+import "log"
+import "flag"
+import "time"
+import "math/big"
+import "strconv"
+import "strings"
+import "unicode/utf8"
+
+import "./kbdlayout"
+import "./kbdscoring"
+import "./gen"
+
+// named groups of positions for -positions
+var positionGroups = map[string][]int{
+	"top":        {0, 1, 2, 3, 4, 5, 6, 7, 8, 9},
+	"home":       {10, 11, 12, 13, 16, 17, 18, 19},
+	"bottom":     {20, 21, 22, 23, 24, 25, 26, 27, 28, 29},
+	"left-home":  {10, 11, 12, 13},
+	"right-home": {16, 17, 18, 19},
+	"inner":      {4, 5, 14, 15, 24, 25},
+}
+
+// most positions searched without pruning, 9! arrangements take
+// under a second to score
+const maxUnprunedPositions = 9
+
+// most positions searched with pruning, which takes seconds for 11
+// positions but grows about tenfold with every position added
+const maxPrunedPositions = 12
+
+// kbdgen optimize -layout <layout> -positions <positions>
+//
+// Finds the best arrangement of the keys on some positions of a layout,
+// keeping the rest of the keys where they are
+func optimizeCommand(args []string) {
+	flags := flag.NewFlagSet("optimize", flag.ExitOnError)
+	var scoringFuncParam = flags.String("scoring-func", "bigram", "which function to use")
+	var layoutParam = flags.String("layout", "", "name of a layout (see kbdgen list) or custom (define with 30 characters)")
+	var positionsParam = flags.String("positions", "home", "comma separated positions 0..29, ranges like 10-13 and groups: top/home/bottom/left-home/right-home/inner")
+	var charactersParam = flags.String("characters", "", "characters to arrange on the positions, moved there from elsewhere if needed, the ones on the positions if empty")
+	var forceParam = flags.Bool("force", false, fmt.Sprintf("search more than %d positions, or %d if the scoring func can't prune the search", maxPrunedPositions, maxUnprunedPositions))
+	common := addCommonFlags(flags)
+	flags.Parse(args)
+	common.apply()
+
+	sf := lookupScoringFunc(*scoringFuncParam)
+	if *layoutParam == "" {
+		log.Fatal("optimize needs a layout, use -layout")
+	}
+	positions, err := parsePositions(*positionsParam)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if _, ok := sf.(kbdscoring.PairwiseScoringFunction); !ok && len(positions) > maxUnprunedPositions && !*forceParam {
+		log.Fatalf("the %s scoring func can't prune the search, so it would score all %s arrangements of %d positions; use at most %d positions, a pairwise scoring func like bigram, or -force",
+			*scoringFuncParam, arrangements(len(positions)), len(positions), maxUnprunedPositions)
+	}
+	if len(positions) > maxPrunedPositions && !*forceParam {
+		log.Fatalf("searching the %s arrangements of %d positions could take hours even with pruning; use at most %d positions or -force",
+			arrangements(len(positions)), len(positions), maxPrunedPositions)
+	}
+
+	sf.Init(defaultMapping)
+	original := findLayout(*layoutParam, defaultMapping)
+	layout := original
+	if *charactersParam != "" {
+		if err := moveCharacters(&layout, positions, *charactersParam, defaultMapping); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	fmt.Printf("%16.12f - original\n", sf.NormalizeScore(sf.CalculateScore(&original)))
+	defaultMapping.PrintLayout(&original)
+
+	start := time.Now()
+	lastProgress := start
+	progress := func(visited, bestScore uint64) {
+		if time.Since(lastProgress) < 5*time.Second {
+			return
+		}
+		lastProgress = time.Now()
+		fmt.Printf("looked at %d arrangements in %s, best so far %16.12f\n",
+			visited, time.Since(start).Round(time.Second), sf.NormalizeScore(bestScore))
+	}
+	score, visited := gen.Optimize(sf, &layout, positions, progress)
+	fmt.Printf("%16.12f - best for positions %v, %d keys moved\n", sf.NormalizeScore(score), positions, kbdlayout.MovedKeys(&layout, &original))
+	defaultMapping.PrintLayout(&layout)
+	fmt.Println(defaultMapping.LayoutString(&layout))
+	fmt.Printf("optimal of %s arrangements, looked at %d partial or complete ones in %s\n",
+		arrangements(len(positions)), visited, time.Since(start).Round(time.Millisecond))
+}
+
+// Parses comma separated positions, ranges and groups
+func parsePositions(spec string) ([]int, error) {
+	var positions []int
+	seen := [30]bool{}
+	add := func(pos int) error {
+		if pos < 0 || pos >= 30 {
+			return fmt.Errorf("position %d is not in 0..29", pos)
+		}
+		if !seen[pos] {
+			seen[pos] = true
+			positions = append(positions, pos)
+		}
+		return nil
+	}
+
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if group, ok := positionGroups[part]; ok {
+			for _, pos := range group {
+				add(pos)
+			}
+			continue
+		}
+
+		bounds := strings.SplitN(part, "-", 2)
+		first, err := strconv.Atoi(bounds[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid position '%s'", part)
+		}
+		last := first
+		if len(bounds) == 2 {
+			if last, err = strconv.Atoi(bounds[1]); err != nil {
+				return nil, fmt.Errorf("invalid position range '%s'", part)
+			}
+			if last < first {
+				return nil, fmt.Errorf("position range '%s' is reversed, use %d-%d", part, last, first)
+			}
+		}
+		for pos := first; pos <= last; pos++ {
+			if err := add(pos); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if len(positions) < 2 {
+		return nil, fmt.Errorf("need at least two positions to arrange")
+	}
+	return positions, nil
+}
+
+// Swaps the characters onto the positions, in place of the
+// characters on the positions that are not among them
+func moveCharacters(layout *kbdlayout.KeyboardLayout, positions []int, characters string, mapping *kbdlayout.KeyboardMapping) error {
+	if count := utf8.RuneCountInString(characters); count != len(positions) {
+		return fmt.Errorf("need %d characters for the positions, got %d", len(positions), count)
+	}
+
+	wanted := map[uint8]bool{}
+	for _, r := range characters {
+		charId, ok := mapping.Rune2ID[mapping.ToLower(r)]
+		if !ok {
+			return fmt.Errorf("character '%c' is not in the mapping", r)
+		}
+		wanted[charId] = true
+	}
+	if len(wanted) != len(positions) {
+		return fmt.Errorf("the characters to arrange have duplicates")
+	}
+
+	onPositions := map[int]bool{}
+	for _, pos := range positions {
+		onPositions[pos] = true
+	}
+
+	for i := 0; i < 30; i++ {
+		if onPositions[i] || !wanted[layout[i]] {
+			continue
+		}
+		// the character is elsewhere, swap it with one not wanted
+		for _, pos := range positions {
+			if !wanted[layout[pos]] {
+				layout[i], layout[pos] = layout[pos], layout[i]
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// Returns the number of arrangements of n keys, n!, which
+// overflows uint64 for more than 20 keys
+func arrangements(n int) *big.Int {
+	return new(big.Int).MulRange(1, int64(n))
+}
@@ -0,0 +1,138 @@
+package main
+
+import "fmt"
+import "log"
+import "flag"
+
+import "./kbdscoring"
+import "./kbdlayout"
+import "./gen"
+
+// Settings for polishing the generated layouts with hill climbing
+type polishing struct {
+	cycles      bool
+	constraints []gen.Constraint
+}
+
+// Polishes the entry in place, returns true if the score improved.
+// Does nothing if polishing is not enabled.
+func (p *polishing) improve(sf kbdscoring.ScoringFunction, entry *gen.LayoutEntry) bool {
+	if p == nil {
+		return false
+	}
+	score := gen.Polish(sf, &entry.Layout, p.cycles, p.constraints...)
+	if score <= entry.Score {
+		return false
+	}
+	entry.Score = score
+	return true
+}
+
+// Polishes the best layouts in the background, one at a time, so that
+// the workers and the screen don't wait for it. A best given while
+// polishing is polished next, the ones given before it are skipped.
+// Not safe for concurrent use, the results are read from done by the
+// same goroutine that starts the polishing.
+type backgroundPolish struct {
+	polish  *polishing
+	sf      kbdscoring.ScoringFunction
+	running bool
+	pending bool // a best was given while polishing
+	// the polished copies, polishing one at a time so the result
+	// never waits to be sent
+	done chan *gen.LayoutEntry
+}
+
+func newBackgroundPolish(polish *polishing, sf kbdscoring.ScoringFunction) *backgroundPolish {
+	return &backgroundPolish{polish: polish, sf: sf, done: make(chan *gen.LayoutEntry, 1)}
+}
+
+// Starts polishing a copy of the best, or after the running polishing.
+// Does nothing if polishing is not enabled.
+func (b *backgroundPolish) start(best *gen.LayoutEntry) {
+	if b.polish == nil {
+		return
+	}
+	if b.running {
+		b.pending = true
+		return
+	}
+	b.running = true
+	entry := *best
+	go func() {
+		b.polish.improve(b.sf, &entry)
+		b.done <- &entry
+	}()
+}
+
+// Has to be called with each polished entry read from done, once it has
+// been taken as the best or not. Polishes the best if it changed meanwhile.
+func (b *backgroundPolish) finished(polished, best *gen.LayoutEntry) {
+	b.running = false
+	if b.pending {
+		b.pending = false
+		if best != polished {
+			b.start(best)
+		}
+	}
+}
+
+// Polishes every layout in the hall of fame. As polished layouts may end
+// up close to each other, they are collected into a new hall of fame.
+func (p *polishing) hallOfFame(sf kbdscoring.ScoringFunction, hallOfFame *gen.HallOfFame, size, minDistance int) *gen.HallOfFame {
+	polished := gen.NewHallOfFame(size, minDistance)
+	for _, entry := range hallOfFame.Entries() {
+		p.improve(sf, &entry)
+		polished.Add(&entry)
+	}
+	return polished
+}
+
+// kbdgen polish -layout <layout>
+//
+// Improves an existing layout with hill climbing
+func polishCommand(args []string) {
+	flags := flag.NewFlagSet("polish", flag.ExitOnError)
+	var scoringFuncParam = flags.String("scoring-func", "monogram", "which function to use")
+	var layoutParam = flags.String("layout", "", "name of a layout (see kbdgen list) or custom (define with 30 characters)")
+	var cyclesParam = flags.Bool("cycles", false, "try rotations of three keys too when no swap improves")
+	var referenceParam = flags.String("reference", "", "layout to compare to with the similarity scoring func and max-moved-keys, the original layout if empty")
+	var maxMovedKeysParam = flags.Int("max-moved-keys", -1, "move at most this many keys from the reference, -1 for no limit")
+	common := addCommonFlags(flags)
+	flags.Parse(args)
+
+	sf := lookupScoringFunc(*scoringFuncParam)
+	if *layoutParam == "" {
+		log.Fatal("polish needs a layout, use -layout")
+	}
+
+	if *referenceParam == "" {
+		*referenceParam = *layoutParam
+	}
+	common.apply()
+	similarityScoringFunc.Reference = findLayoutString(*referenceParam)
+
+	sf.Init(defaultMapping)
+	original := findLayout(*layoutParam, defaultMapping)
+	entry := gen.LayoutEntry{Layout: original}
+	entry.Score = sf.CalculateScore(&entry.Layout)
+
+	fmt.Printf("%16.12f - original\n", sf.NormalizeScore(entry.Score))
+	defaultMapping.PrintLayout(&entry.Layout)
+
+	polish := &polishing{cycles: *cyclesParam}
+	if *maxMovedKeysParam >= 0 {
+		polish.constraints = append(polish.constraints, &gen.MaxMovedKeys{
+			Reference: findLayout(*referenceParam, defaultMapping),
+			Max:       *maxMovedKeysParam,
+		})
+	}
+	if !polish.improve(sf, &entry) {
+		fmt.Println("no improvement found")
+		return
+	}
+
+	fmt.Printf("%16.12f - polished, %d swaps away\n", sf.NormalizeScore(entry.Score), kbdlayout.SwapDistance(&original, &entry.Layout))
+	defaultMapping.PrintLayout(&entry.Layout)
+	fmt.Println(defaultMapping.LayoutString(&entry.Layout))
+}
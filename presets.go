@@ -0,0 +1,172 @@
+package main
+
+import "fmt"
+import "log"
+import "sort"
+import "strings"
+
+import "./kbdlayout"
+import "./kbdscoring"
+import "./gen"
+
+// Language preset, bundling the characters to place on the 30 keys
+// with the corpus and the layout the scores are compared to. Characters
+// that don't fit on the 30 keys go on the extra keys of
+// kbdlayout.ExtraKeys, right of the 30 keys like å and ü next to p. The
+// generator evolves the 30 keys and then places the extra characters
+// along with them, which can move some of them to the 30 keys.
+type preset struct {
+	title      string
+	locale     string // for lowercasing and folding, see kbdlayout.NewLocaleMapping
+	characters string // the 30 characters the generator places
+	extra      string // characters on the extra keys, at most one for each
+	monograms  string // corpus files
+	bigrams    string
+	baseline   string // name of the layout for normalizing
+}
+
+var presets = map[string]*preset{
+	"en": &preset{
+		title:      "English",
+		locale:     "en",
+		characters: "abcdefghijklmnopqrstuvwxyz.,;/",
+		monograms:  "monograms.txt",
+		bigrams:    "bigrams.txt",
+		baseline:   "qwerty",
+	},
+	"fi": &preset{
+		title:      "Finnish",
+		locale:     "fi",
+		characters: "abcdefghijklmnopqrstuvwxyzäö,.",
+		extra:      "å-",
+		monograms:  "monograms-fi.txt",
+		bigrams:    "bigrams-fi.txt",
+		baseline:   "qwerty-fi",
+	},
+	"de": &preset{
+		title:      "German",
+		locale:     "de",
+		characters: "abcdefghijklmnopqrstuvwxyzäö,.",
+		extra:      "üß-",
+		monograms:  "monograms-de.txt",
+		bigrams:    "bigrams-de.txt",
+		baseline:   "qwertz-de",
+	},
+	"fr": &preset{
+		title:      "French",
+		locale:     "fr",
+		characters: "abcdefghijklmnopqrstuvwxyzéèàç",
+		extra:      ",;:!",
+		monograms:  "monograms-fr.txt",
+		bigrams:    "bigrams-fr.txt",
+		baseline:   "azerty-fr",
+	},
+}
+
+// the preset chosen with -lang, English until the flags are applied
+var activePreset = presets["en"]
+
+// mapping of the characters of the active preset, the ones on the
+// extra keys after the 30
+var defaultMapping = kbdlayout.NewMapping(activePreset.characters)
+
+// Activates the preset and creates the default mapping for it
+func usePreset(name string) {
+	p, ok := presets[name]
+	if !ok {
+		names := make([]string, 0, len(presets))
+		for name := range presets {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		log.Fatalf("could not find language preset '%s', use one of %v", name, names)
+	}
+	activePreset = p
+	defaultMapping = kbdlayout.NewLocaleMapping(p.characters+p.extra, p.locale)
+}
+
+// Returns the characters on the extra keys of the preset that are
+// not among the characters
+func presetExtra(characters string) string {
+	var extra []rune
+	for _, r := range activePreset.extra {
+		if !strings.ContainsRune(characters, r) {
+			extra = append(extra, r)
+		}
+	}
+	return string(extra)
+}
+
+// Prints the characters on the extra keys of the preset, if any
+func printExtraKeys() {
+	if activePreset.extra != "" {
+		fmt.Printf("extra keys: %s\n", strings.Join(strings.Split(activePreset.extra, ""), " "))
+	}
+}
+
+// Placing of the extra characters after generating the 30 keys
+type extraKeys struct {
+	sf          kbdscoring.ExtraKeysScoringFunction
+	characters  []uint8
+	constraints []gen.Constraint
+}
+
+// Returns the placing of the extra characters of the mapping, which are
+// the ones after the first 30, or nil if there are none or the scoring
+// func can't score them
+func newExtraKeys(sf kbdscoring.ScoringFunction, name string, mapping *kbdlayout.KeyboardMapping, constraints []gen.Constraint) *extraKeys {
+	if len(mapping.ID2Rune) <= 30 {
+		return nil
+	}
+	extraSf, ok := sf.(kbdscoring.ExtraKeysScoringFunction)
+	if !ok {
+		fmt.Printf("the %s scoring func can't place the extra keys, leaving out %s\n", name, string(mapping.ID2Rune[30:]))
+		return nil
+	}
+	e := &extraKeys{sf: extraSf, constraints: constraints}
+	for charId := 30; charId < len(mapping.ID2Rune); charId++ {
+		e.characters = append(e.characters, uint8(charId))
+	}
+	return e
+}
+
+// Places the extra characters along with the layout of the entry,
+// which may change, and returns them by extra key. The score of the
+// entry becomes the score with the extra keys.
+func (e *extraKeys) place(entry *gen.LayoutEntry) []uint8 {
+	extra := append([]uint8(nil), e.characters...)
+	entry.Score = gen.PlaceExtraKeys(e.sf, &entry.Layout, extra, e.constraints...)
+	return extra
+}
+
+// Describes the characters on the extra keys, e.g. "å top 10, - home 10"
+func describeExtraKeys(mapping *kbdlayout.KeyboardMapping, extra []uint8) string {
+	keys := make([]string, len(extra))
+	for i, charId := range extra {
+		keys[i] = fmt.Sprintf("%c %s", mapping.ID2Rune[charId], kbdlayout.ExtraKeys[i])
+	}
+	return strings.Join(keys, ", ")
+}
+
+// Returns the characters on the extra keys in their order
+func extraString(mapping *kbdlayout.KeyboardMapping, extra []uint8) string {
+	runes := make([]rune, len(extra))
+	for i, charId := range extra {
+		runes[i] = mapping.ID2Rune[charId]
+	}
+	return string(runes)
+}
+
+// Prints the entry with the extra characters placed, if there are any
+func (e *extraKeys) print(sf kbdscoring.ScoringFunction, mapping *kbdlayout.KeyboardMapping, entry *gen.LayoutEntry) {
+	if e == nil {
+		return
+	}
+	placed := *entry
+	extra := e.place(&placed)
+	fmt.Printf("with the extra keys: %16.12f\n", sf.NormalizeScore(placed.Score))
+	if placed.Layout != entry.Layout {
+		mapping.PrintLayout(&placed.Layout)
+	}
+	fmt.Printf("extra keys: %s\n", describeExtraKeys(mapping, extra))
+}
@@ -0,0 +1,52 @@
+package main
+
+import "fmt"
+import "log"
+import "strconv"
+import "strings"
+
+import "./kbdscoring"
+
+var monogramScoringFunc = &kbdscoring.MonogramScoringFunc{}
+var bigramScoringFunc = &kbdscoring.BigramScoringFunc{}
+var similarityScoringFunc = &kbdscoring.SimilarityScoringFunc{}
+var compositeScoringFunc = &kbdscoring.CompositeScoringFunc{}
+
+var scoringFuncs = map[string]kbdscoring.ScoringFunction{
+	"monogram":   monogramScoringFunc,
+	"bigram":     bigramScoringFunc,
+	"similarity": similarityScoringFunc,
+	"composite":  compositeScoringFunc,
+}
+
+// Parses comma separated name:weight pairs
+func parseComposite(spec string) ([]kbdscoring.CompositeTerm, error) {
+	var terms []kbdscoring.CompositeTerm
+	for _, part := range strings.Split(spec, ",") {
+		nameAndWeight := strings.SplitN(part, ":", 2)
+		name := strings.TrimSpace(nameAndWeight[0])
+		weight := 1.0
+		if len(nameAndWeight) == 2 {
+			var err error
+			weight, err = strconv.ParseFloat(strings.TrimSpace(nameAndWeight[1]), 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid weight for '%s' in composite: %v", name, err)
+			}
+		}
+
+		sf, ok := scoringFuncs[name]
+		if !ok || sf == compositeScoringFunc {
+			return nil, fmt.Errorf("could not find scoring func '%s' for composite", name)
+		}
+		terms = append(terms, kbdscoring.CompositeTerm{Func: sf, Weight: weight})
+	}
+	return terms, nil
+}
+
+func lookupScoringFunc(name string) kbdscoring.ScoringFunction {
+	sf, ok := scoringFuncs[name]
+	if !ok {
+		log.Fatalf("could not find scoring func '%s'", name)
+	}
+	return sf
+}
@@ -0,0 +1,594 @@
+package main
+
+import "fmt"
+import "log"
+import "flag"
+import "sort"
+import "sync"
+import "time"
+import "bytes"
+import "context"
+import "strconv"
+import "strings"
+import "net/http"
+import "unicode/utf8"
+import "encoding/json"
+
+import "./kbdscoring"
+import "./kbdlayout"
+import "./gen"
+
+// kbdgen serve [-addr localhost:8080]
+//
+// Serves a JSON API for scoring layouts and running generation jobs:
+//
+//	GET    /layouts                   known layouts
+//	GET    /scoring-funcs             names of the scoring functions
+//	GET    /score?layout=...          scores of a layout, name or 30 characters,
+//	                                  with all the scoring funcs or the
+//	                                  comma separated ones in scoring-func
+//	GET    /jobs                      the running jobs and the last -keep-jobs
+//	                                  finished ones
+//	POST   /jobs                      starts a job, see jobRequest
+//	GET    /jobs/<id>                 status and best layout of the job
+//	DELETE /jobs/<id>                 stops the job
+//	GET    /jobs/<id>/events          new bests as server-sent events
+//
+// All the jobs use the characters of the language preset and the threads
+// of -max-procs, as the threads are shared by the jobs. The status of a
+// job tells how the workers of the job have spent their time, the same
+// stats of all the jobs are served with expvar when -debug-addr is given.
+func serveCommand(args []string) {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	var addrParam = flags.String("addr", "localhost:8080", "address to listen to")
+	var maxJobsParam = flags.Int("max-jobs", 1, "maximum number of jobs running at the same time")
+	var keepJobsParam = flags.Int("keep-jobs", 100, "number of finished jobs to keep the status of, the oldest ones are forgotten")
+	var maxProcsParam = flags.Int("max-procs", gen.DefaultOptions().MaxProcs, "maximum number of threads to run the workers of all the jobs on")
+	var debugAddrParam = flags.String("debug-addr", "", "address to serve the stats of the jobs with expvar and profiles with pprof on, e.g. localhost:6060")
+	common := addCommonFlags(flags)
+	flags.Parse(args)
+	common.apply()
+
+	if *keepJobsParam < 0 {
+		log.Fatalf("keep-jobs must not be negative, got %d", *keepJobsParam)
+	}
+	if *maxProcsParam < 1 {
+		log.Fatalf("max-procs must be at least 1, got %d", *maxProcsParam)
+	}
+	if runeCount := utf8.RuneCountInString(activePreset.characters); runeCount != 30 {
+		log.Fatalf("the generator needs exactly 30 characters, got %d", runeCount)
+	}
+	similarityScoringFunc.Reference = findLayoutString(activePreset.baseline)
+	// the scoring funcs are shared by the requests and the jobs,
+	// they are only read after this
+	for _, name := range scoringFuncNames() {
+		scoringFuncs[name].Init(defaultMapping)
+	}
+
+	s := &server{jobs: map[int]*job{}, maxJobs: *maxJobsParam, keepJobs: *keepJobsParam, maxProcs: *maxProcsParam}
+	if *debugAddrParam != "" {
+		serveDebug(*debugAddrParam, s.stats)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/layouts", s.handleLayouts)
+	mux.HandleFunc("/scoring-funcs", s.handleScoringFuncs)
+	mux.HandleFunc("/score", s.handleScore)
+	mux.HandleFunc("/jobs", s.handleJobs)
+	mux.HandleFunc("/jobs/", s.handleJob)
+
+	fmt.Printf("listening on http://%s\n", *addrParam)
+	log.Fatal(http.ListenAndServe(*addrParam, mux))
+}
+
+// Returns the names of the scoring functions in alphabetical order
+func scoringFuncNames() []string {
+	names := make([]string, 0, len(scoringFuncs))
+	for name := range scoringFuncs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+type server struct {
+	mutex    sync.Mutex
+	jobs     map[int]*job
+	nextID   int
+	maxJobs  int
+	keepJobs int // finished jobs kept for their status
+	maxProcs int // threads of the workers of all the jobs
+}
+
+// Forgets the oldest finished jobs, so that at most keepJobs of them
+// are left. Has to be called with the mutex locked.
+func (s *server) pruneJobs() {
+	var finished []int
+	for id, j := range s.jobs {
+		if !j.running() {
+			finished = append(finished, id)
+		}
+	}
+	if len(finished) <= s.keepJobs {
+		return
+	}
+	sort.Ints(finished)
+	for _, id := range finished[:len(finished)-s.keepJobs] {
+		delete(s.jobs, id)
+	}
+}
+
+// Returns the stats of the workers of each job by the id of the job
+func (s *server) stats() interface{} {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	stats := map[string][]gen.WorkerStats{}
+	for id, j := range s.jobs {
+		stats[strconv.Itoa(id)] = j.opts.Stats.Workers()
+	}
+	return stats
+}
+
+type layoutResponse struct {
+	Name     string   `json:"name"`
+	Title    string   `json:"title,omitempty"`
+	Author   string   `json:"author,omitempty"`
+	Year     int      `json:"year,omitempty"`
+	Language string   `json:"language,omitempty"`
+	Geometry string   `json:"geometry,omitempty"`
+	Layers   []string `json:"layers"`
+}
+
+type scoreResponse struct {
+	Score float64 `json:"score"` // normalized
+	Raw   uint64  `json:"raw"`
+}
+
+func (s *server) handleLayouts(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, "GET") {
+		return
+	}
+	layouts := []layoutResponse{}
+	for _, name := range library.Names() {
+		info, _ := library.Lookup(name)
+		layouts = append(layouts, layoutResponse{
+			Name:     info.Name,
+			Title:    info.Title,
+			Author:   info.Author,
+			Year:     info.Year,
+			Language: info.Language,
+			Geometry: info.Geometry,
+			Layers:   info.Layers,
+		})
+	}
+	writeJSON(w, http.StatusOK, layouts)
+}
+
+func (s *server) handleScoringFuncs(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, "GET") {
+		return
+	}
+	writeJSON(w, http.StatusOK, scoringFuncNames())
+}
+
+func (s *server) handleScore(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, "GET") {
+		return
+	}
+	query := r.URL.Query()
+	name := query.Get("layout")
+	if name == "" {
+		writeError(w, http.StatusBadRequest, "missing layout")
+		return
+	}
+	layoutString := name
+	if info, ok := library.Lookup(name); ok {
+		layoutString = info.Base()
+	}
+	layout, err := kbdlayout.ParseLayout(layoutString, defaultMapping)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	names := scoringFuncNames()
+	if query.Get("scoring-func") != "" {
+		names = strings.Split(query.Get("scoring-func"), ",")
+	}
+	scores := map[string]scoreResponse{}
+	for _, name := range names {
+		sf, ok := scoringFuncs[name]
+		if !ok {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("could not find scoring func '%s'", name))
+			return
+		}
+		score := sf.CalculateScore(&layout)
+		scores[name] = scoreResponse{Score: sf.NormalizeScore(score), Raw: score}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"layout": defaultMapping.LayoutString(&layout),
+		"scores": scores,
+	})
+}
+
+// Body of POST /jobs. The options not given are the defaults, and
+// max-procs is the one of the server, the stopping criteria not given
+// are not used.
+type jobRequest struct {
+	ScoringFunc    string          `json:"scoring-func"`
+	Options        json.RawMessage `json:"options"` // see gen.Options
+	MaxTime        string          `json:"max-time"`
+	MaxGenerations uint64          `json:"max-generations"`
+	TargetScore    float64         `json:"target-score"`
+	Stagnation     uint64          `json:"stagnation"`
+}
+
+func (s *server) handleJobs(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, "GET", "POST") {
+		return
+	}
+	if r.Method == "GET" {
+		s.mutex.Lock()
+		jobs := make([]*job, 0, len(s.jobs))
+		for _, j := range s.jobs {
+			jobs = append(jobs, j)
+		}
+		s.mutex.Unlock()
+
+		sort.Slice(jobs, func(a, b int) bool { return jobs[a].id < jobs[b].id })
+		statuses := []jobStatus{}
+		for _, j := range jobs {
+			statuses = append(statuses, j.status())
+		}
+		writeJSON(w, http.StatusOK, statuses)
+		return
+	}
+
+	j, err := newJob(r, s.maxProcs)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.mutex.Lock()
+	running := 0
+	for _, other := range s.jobs {
+		if other.running() {
+			running++
+		}
+	}
+	if running >= s.maxJobs {
+		s.mutex.Unlock()
+		j.cancel()
+		writeError(w, http.StatusServiceUnavailable, fmt.Sprintf("already running %d jobs", running))
+		return
+	}
+	s.nextID++
+	j.id = s.nextID
+	s.jobs[j.id] = j
+	s.pruneJobs()
+	s.mutex.Unlock()
+
+	go j.run()
+	writeJSON(w, http.StatusCreated, j.status())
+}
+
+// Handles /jobs/<id> and /jobs/<id>/events
+func (s *server) handleJob(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/jobs/"), "/")
+	id, err := strconv.Atoi(parts[0])
+	if err != nil || len(parts) > 2 || len(parts) == 2 && parts[1] != "events" {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	s.mutex.Lock()
+	j, ok := s.jobs[id]
+	s.mutex.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("no job %d", id))
+		return
+	}
+
+	if len(parts) == 2 {
+		if allowMethods(w, r, "GET") {
+			j.streamEvents(w, r)
+		}
+		return
+	}
+	if !allowMethods(w, r, "GET", "DELETE") {
+		return
+	}
+	if r.Method == "DELETE" {
+		j.stop("stopped by request")
+		// wait for the job to finish, so the status tells the final best
+		<-j.finished
+	}
+	writeJSON(w, http.StatusOK, j.status())
+}
+
+// Generation job, evolving populations until a stopping criteria is met
+// or the job is stopped. Works like the generator on the command line.
+type job struct {
+	id       int
+	sfName   string
+	sf       kbdscoring.ScoringFunction
+	opts     gen.Options
+	criteria stopCriteria
+	started  time.Time
+
+	// the workers run until the context is done, stop cancels it
+	ctx    context.Context
+	cancel context.CancelFunc
+	// closed when the job has finished
+	finished chan struct{}
+
+	mutex      sync.Mutex
+	reason     string    // why the job finished
+	ended      time.Time // zero while running
+	generation uint64
+	best       *gen.LayoutEntry
+	listeners  map[chan *gen.LayoutEntry]bool
+}
+
+// Makes a job of the request. The options of a job can't change the
+// threads, as they are shared by all the jobs, see gen.Start.
+func newJob(r *http.Request, maxProcs int) (*job, error) {
+	var request jobRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&request); err != nil {
+		return nil, fmt.Errorf("invalid job: %v", err)
+	}
+
+	j := &job{
+		sfName:    request.ScoringFunc,
+		opts:      gen.DefaultOptions(),
+		started:   time.Now(),
+		finished:  make(chan struct{}),
+		listeners: map[chan *gen.LayoutEntry]bool{},
+	}
+	if j.sfName == "" {
+		j.sfName = "monogram"
+	}
+	sf, ok := scoringFuncs[j.sfName]
+	if !ok {
+		return nil, fmt.Errorf("could not find scoring func '%s'", j.sfName)
+	}
+	j.sf = sf
+
+	j.opts.MaxProcs = maxProcs
+	if len(request.Options) > 0 {
+		decoder := json.NewDecoder(bytes.NewReader(request.Options))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&j.opts); err != nil {
+			return nil, fmt.Errorf("invalid options: %v", err)
+		}
+	}
+	if j.opts.MaxProcs != maxProcs {
+		return nil, fmt.Errorf("invalid options: max-procs is %d for all the jobs, set with -max-procs of the server", maxProcs)
+	}
+	if err := j.opts.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid options: %v", err)
+	}
+	j.opts.Stats = gen.NewStats(j.opts.Workers)
+
+	if request.MaxTime != "" {
+		maxTime, err := time.ParseDuration(request.MaxTime)
+		if err != nil {
+			return nil, fmt.Errorf("invalid max-time: %v", err)
+		}
+		j.criteria.maxTime = maxTime
+	}
+	j.criteria.maxGenerations = request.MaxGenerations
+	j.criteria.targetScore = request.TargetScore
+	j.criteria.stagnation = request.Stagnation
+
+	// the time limit starts when the job runs, see run
+	j.ctx, j.cancel = context.WithCancel(context.Background())
+	return j, nil
+}
+
+// Stops the workers of the job, can be called many times.
+// The first reason given is kept.
+func (j *job) stop(reason string) {
+	j.mutex.Lock()
+	if j.reason == "" {
+		j.reason = reason
+	}
+	j.mutex.Unlock()
+	j.cancel()
+}
+
+func (j *job) running() bool {
+	select {
+	case <-j.finished:
+		return false
+	default:
+		return true
+	}
+}
+
+func (j *job) run() {
+	defer close(j.finished)
+	defer func() {
+		j.mutex.Lock()
+		j.ended = time.Now()
+		j.mutex.Unlock()
+	}()
+
+	ctx := j.ctx
+	if j.criteria.maxTime > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(j.ctx, j.criteria.maxTime)
+		defer cancel()
+	}
+
+	var lastImprovement uint64
+	_, err := gen.Run(ctx, j.sf, &j.opts, func(next *gen.LayoutEntry, generation uint64, improved bool) bool {
+		j.mutex.Lock()
+		defer j.mutex.Unlock()
+
+		j.generation = generation
+		if improved {
+			j.best = next
+			lastImprovement = generation
+			for listener := range j.listeners {
+				// listeners that can't keep up only miss bests,
+				// they'll get the latest one on the next send
+				select {
+				case listener <- next:
+				default:
+				}
+			}
+		}
+		if reason := j.criteria.reason(j.sf, j.best, generation, lastImprovement); reason != "" && j.reason == "" {
+			j.reason = reason
+			return true
+		}
+		return false
+	})
+	j.cancel()
+
+	if err == context.DeadlineExceeded {
+		j.mutex.Lock()
+		if j.reason == "" {
+			j.reason = fmt.Sprintf("reached time limit %s", j.criteria.maxTime)
+		}
+		j.mutex.Unlock()
+	}
+}
+
+type jobStatus struct {
+	ID          int         `json:"id"`
+	ScoringFunc string      `json:"scoring-func"`
+	Running     bool        `json:"running"`
+	Reason      string      `json:"reason,omitempty"`
+	Started     time.Time   `json:"started"`
+	Elapsed     string      `json:"elapsed"`
+	Generation  uint64      `json:"generation"`
+	Best        *jobBest    `json:"best,omitempty"`
+	Options     gen.Options `json:"options"`
+
+	Workers []gen.WorkerStats `json:"workers"`
+}
+
+type jobBest struct {
+	scoreResponse
+	Layout string    `json:"layout"`
+	Rows   [3]string `json:"rows"`
+}
+
+func (j *job) status() jobStatus {
+	// finished is checked first, so a finished job has its reason set
+	running := j.running()
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	elapsed := time.Since(j.started)
+	if !j.ended.IsZero() {
+		elapsed = j.ended.Sub(j.started)
+	}
+	return jobStatus{
+		ID:          j.id,
+		ScoringFunc: j.sfName,
+		Running:     running,
+		Reason:      j.reason,
+		Started:     j.started,
+		Elapsed:     elapsed.Round(time.Millisecond).String(),
+		Generation:  j.generation,
+		Best:        j.bestResponse(j.best),
+		Options:     j.opts,
+		Workers:     j.opts.Stats.Workers(),
+	}
+}
+
+func (j *job) bestResponse(best *gen.LayoutEntry) *jobBest {
+	if best == nil {
+		return nil
+	}
+	return &jobBest{
+		scoreResponse: scoreResponse{Score: j.sf.NormalizeScore(best.Score), Raw: best.Score},
+		Layout:        defaultMapping.LayoutString(&best.Layout),
+		Rows:          defaultMapping.LayoutRows(&best.Layout),
+	}
+}
+
+// Streams the current best and every new best as "best" events,
+// followed by an "end" event with the status when the job finishes
+func (j *job) streamEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming not supported")
+		return
+	}
+
+	listener := make(chan *gen.LayoutEntry, 1)
+	j.mutex.Lock()
+	j.listeners[listener] = true
+	best := j.best
+	j.mutex.Unlock()
+	defer func() {
+		j.mutex.Lock()
+		delete(j.listeners, listener)
+		j.mutex.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if best != nil {
+		writeEvent(w, "best", j.bestResponse(best))
+	}
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			// the client went away
+			return
+		case best := <-listener:
+			writeEvent(w, "best", j.bestResponse(best))
+			flusher.Flush()
+		case <-j.finished:
+			writeEvent(w, "end", j.status())
+			flusher.Flush()
+			return
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, event string, data interface{}) {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, encoded)
+}
+
+// Tells if the request has one of the methods, and responds
+// with an error if not
+func allowMethods(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, method := range methods {
+		if r.Method == method {
+			return true
+		}
+	}
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	writeError(w, http.StatusMethodNotAllowed, fmt.Sprintf("method %s not allowed", r.Method))
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, code int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(data); err != nil {
+		log.Print(err)
+	}
+}
+
+func writeError(w http.ResponseWriter, code int, message string) {
+	writeJSON(w, code, map[string]string{"error": message})
+}
@@ -0,0 +1,228 @@
+package main
+
+import "io"
+import "os"
+import "fmt"
+import "log"
+import "flag"
+import "sort"
+import "bufio"
+import "strings"
+import "unicode"
+
+import "./kbdlayout"
+
+// kbdgen simulate -layout <layout> file...
+//
+// Types text files on a layout, showing how much the fingers move
+func simulateCommand(args []string) {
+	flags := flag.NewFlagSet("simulate", flag.ExitOnError)
+	var layoutParam = flags.String("layout", "", "name of a layout (see kbdgen list) or custom (define with 30 characters)")
+	var geometryParam = flags.String("geometry", "staggered", "physical arrangement of the keys: staggered/ortholinear")
+	var returnHomeParam = flags.Bool("return-home", true, "move fingers back to their home keys when another finger presses a key")
+	common := addCommonFlags(flags)
+	flags.Parse(args)
+	common.apply()
+
+	if *layoutParam == "" {
+		log.Fatal("simulate needs a layout, use -layout")
+	}
+	if flags.NArg() == 0 {
+		log.Fatal("simulate needs text files to type, - for standard input")
+	}
+	geometry, ok := kbdlayout.Geometries[*geometryParam]
+	if !ok {
+		log.Fatalf("unknown geometry '%s'", *geometryParam)
+	}
+
+	layout := findLayout(*layoutParam, defaultMapping)
+	s := newSimulation(&layout, defaultMapping, geometry, *returnHomeParam)
+	for _, filename := range flags.Args() {
+		if filename == "-" {
+			s.typeText(os.Stdin)
+			continue
+		}
+		file, err := os.Open(filename)
+		if err != nil {
+			log.Fatal(err)
+		}
+		s.typeText(file)
+		file.Close()
+	}
+	s.finish()
+
+	defaultMapping.PrintLayout(&layout)
+	s.print()
+}
+
+// length of the text shown for the longest same hand run
+const maxRunText = 40
+
+// Typing of text on a layout, one character at a time
+type simulation struct {
+	mapping    *kbdlayout.KeyboardMapping
+	geometry   *kbdlayout.Geometry
+	returnHome bool
+	positions  map[rune]int // position of each character on the layout
+
+	// where each finger is, and the finger that pressed the previous key
+	fingerAt   [8]int
+	lastFinger int // -1 if none
+
+	characters int // all the characters typed, including whitespace
+	presses    [8]int
+	travel     [8]float64 // in key widths
+	unmapped   map[rune]int
+
+	// current and longest run of keys on the same hand
+	run            []rune
+	runHand        kbdlayout.Hand
+	longestRun     []rune
+	longestRunHand kbdlayout.Hand
+}
+
+func newSimulation(layout *kbdlayout.KeyboardLayout, mapping *kbdlayout.KeyboardMapping, geometry *kbdlayout.Geometry, returnHome bool) *simulation {
+	s := &simulation{
+		mapping:    mapping,
+		geometry:   geometry,
+		returnHome: returnHome,
+		positions:  map[rune]int{},
+		lastFinger: -1,
+		unmapped:   map[rune]int{},
+	}
+	for i := 0; i < 30; i++ {
+		s.positions[mapping.ID2Rune[layout[i]]] = i
+	}
+	for f := range s.fingerAt {
+		s.fingerAt[f] = kbdlayout.HomePosition(kbdlayout.Finger(f))
+	}
+	return s
+}
+
+func (s *simulation) typeText(r io.Reader) {
+	reader := bufio.NewReader(r)
+	for {
+		char, _, err := reader.ReadRune()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		s.typeRune(char)
+	}
+}
+
+func (s *simulation) typeRune(char rune) {
+	s.characters++
+	if unicode.IsSpace(char) {
+		// thumbs and the like, the typing fingers don't move
+		s.endRun()
+		return
+	}
+
+	pos, ok := s.positions[s.mapping.ToLower(char)]
+	if !ok {
+		s.unmapped[char]++
+		s.endRun()
+		return
+	}
+
+	finger := kbdlayout.FingerOf(pos)
+	if s.returnHome && s.lastFinger >= 0 && s.lastFinger != int(finger) {
+		s.moveHome(s.lastFinger)
+	}
+	s.travel[finger] += s.geometry.Distance(s.fingerAt[finger], pos)
+	s.fingerAt[finger] = pos
+	s.presses[finger]++
+	s.lastFinger = int(finger)
+
+	if len(s.run) > 0 && s.runHand != finger.Hand() {
+		s.endRun()
+	}
+	s.run = append(s.run, char)
+	s.runHand = finger.Hand()
+}
+
+func (s *simulation) moveHome(f int) {
+	home := kbdlayout.HomePosition(kbdlayout.Finger(f))
+	s.travel[f] += s.geometry.Distance(s.fingerAt[f], home)
+	s.fingerAt[f] = home
+}
+
+func (s *simulation) endRun() {
+	if len(s.run) > len(s.longestRun) {
+		s.longestRun = append([]rune(nil), s.run...)
+		s.longestRunHand = s.runHand
+	}
+	s.run = s.run[:0]
+}
+
+// Ends the text, returning the fingers home
+func (s *simulation) finish() {
+	s.endRun()
+	if s.returnHome {
+		for f := range s.fingerAt {
+			s.moveHome(f)
+		}
+	}
+}
+
+func (s *simulation) print() {
+	totalPresses := 0
+	totalTravel := 0.0
+	var handPresses [2]int
+	for f := range s.presses {
+		totalPresses += s.presses[f]
+		totalTravel += s.travel[f]
+		handPresses[kbdlayout.Finger(f).Hand()] += s.presses[f]
+	}
+	unmapped := 0
+	for _, count := range s.unmapped {
+		unmapped += count
+	}
+
+	fmt.Printf("\n%d characters, %d keys pressed, %d characters not on the layout\n", s.characters, totalPresses, unmapped)
+	if totalPresses == 0 {
+		return
+	}
+	fmt.Printf("finger travel %.1f key widths (%.1f m), %.3f per key press\n",
+		totalTravel, totalTravel*kbdlayout.KeyWidthMM/1000, totalTravel/float64(totalPresses))
+
+	fmt.Printf("\n%-14s %10s %7s %12s %7s\n", "finger", "presses", "share", "travel", "share")
+	for f := range s.presses {
+		travelShare := 0.0
+		if totalTravel > 0 {
+			travelShare = 100 * s.travel[f] / totalTravel
+		}
+		fmt.Printf("%-14s %10d %6.2f%% %12.1f %6.2f%%\n", kbdlayout.Finger(f),
+			s.presses[f], 100*float64(s.presses[f])/float64(totalPresses), s.travel[f], travelShare)
+	}
+	fmt.Printf("\nleft hand %.2f%%, right hand %.2f%%\n",
+		100*float64(handPresses[kbdlayout.Left])/float64(totalPresses),
+		100*float64(handPresses[kbdlayout.Right])/float64(totalPresses))
+
+	run := string(s.longestRun)
+	if len(s.longestRun) > maxRunText {
+		run = string(s.longestRun[:maxRunText]) + "..."
+	}
+	fmt.Printf("longest same hand run: %d keys on the %s hand, \"%s\"\n", len(s.longestRun), s.longestRunHand, run)
+
+	if unmapped > 0 {
+		chars := make([]rune, 0, len(s.unmapped))
+		for char := range s.unmapped {
+			chars = append(chars, char)
+		}
+		sort.Slice(chars, func(i, j int) bool {
+			if s.unmapped[chars[i]] != s.unmapped[chars[j]] {
+				return s.unmapped[chars[i]] > s.unmapped[chars[j]]
+			}
+			return chars[i] < chars[j]
+		})
+		var counts []string
+		for _, char := range chars {
+			counts = append(counts, fmt.Sprintf("%q %d", char, s.unmapped[char]))
+		}
+		fmt.Printf("not on the layout: %s\n", strings.Join(counts, ", "))
+	}
+}
@@ -0,0 +1,428 @@
+package main
+
+import "os"
+import "fmt"
+import "log"
+import "time"
+import "strings"
+import "context"
+import "os/exec"
+import "os/signal"
+
+import "./kbdscoring"
+import "./kbdlayout"
+import "./gen"
+
+// keys of the terminal UI, arrows are mapped to hjkl
+const tuiHelp = "space pause  arrows/hjkl move  p pin/unpin  s save  q stop"
+
+// number of score samples in the sparkline, one per second
+const sparklineWidth = 60
+
+var sparkBars = []rune("▁▂▃▄▅▆▇█")
+
+// State of the terminal UI, updated from the generationBest
+// channel and the keys
+type tui struct {
+	sf        kbdscoring.ScoringFunction
+	mapping   *kbdlayout.KeyboardMapping
+	reference *kbdlayout.KeyboardLayout // nil if it can't be mapped
+	pins      *gen.Pins
+	saveFile  string
+
+	best            *gen.LayoutEntry
+	generation      uint64
+	lastImprovement uint64
+	workers         []workerProgress
+	history         []float64 // best normalized score every second
+
+	started        time.Time
+	rate           float64 // generations per second
+	rateGeneration uint64  // generation and time the rate was last counted at
+	rateTime       time.Time
+
+	paused  bool
+	cursor  int // position on the layout
+	message string
+
+	// the best is polished in the background, so the screen and the
+	// workers don't wait for it
+	polish *backgroundPolish
+}
+
+type workerProgress struct {
+	generation uint64
+	best       uint64
+	diversity  float64
+}
+
+// Runs the generator like generateLayouts, but shows the progress in the
+// terminal in place instead of printing it. The pins are steered with the
+// keys, they have to be among the constraints of the options.
+func generateLayoutsTUI(sf kbdscoring.ScoringFunction, mapping *kbdlayout.KeyboardMapping, opts *gen.Options, stop *stopCriteria, polish *polishing, hallOfFame *gen.HallOfFame, pins *gen.Pins, reference string, saveFile string) {
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, os.Kill)
+	defer signal.Stop(quit)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// the workers block on sending when paused, as nobody reads the channel
+	generationBest, err := gen.Start(ctx, sf, opts)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	restore := enterTerminal()
+	var keys <-chan rune = readKeys()
+
+	t := &tui{
+		sf:       sf,
+		mapping:  mapping,
+		pins:     pins,
+		saveFile: saveFile,
+		workers:  make([]workerProgress, opts.Workers),
+		started:  time.Now(),
+		rateTime: time.Now(),
+		polish:   newBackgroundPolish(polish, sf),
+	}
+	if layout, err := kbdlayout.ParseLayout(findLayoutString(reference), mapping); err == nil {
+		t.reference = &layout
+	}
+
+	var timeout <-chan time.Time
+	if stop.maxTime > 0 {
+		timeout = time.After(stop.maxTime)
+	}
+
+	redraw := time.NewTicker(250 * time.Millisecond)
+	defer redraw.Stop()
+	sample := time.NewTicker(time.Second)
+	defer sample.Stop()
+
+	// restore the terminal before printing the final best, whatever the reason
+	reason := ""
+	defer func() {
+		restore()
+		if reason != "" {
+			fmt.Printf("stopping: %s\n", reason)
+		}
+		if t.best != nil {
+			fmt.Printf("\nfinal best: %16.12f after %d generations\n", sf.NormalizeScore(t.best.Score), t.generation)
+			mapping.PrintLayout(&t.best.Layout)
+		}
+	}()
+
+	for {
+		incoming := generationBest
+		if t.paused {
+			incoming = nil
+		}
+
+		select {
+		case sig := <-quit:
+			reason = fmt.Sprintf("got signal: %s", sig.String())
+			return
+		case <-timeout:
+			reason = fmt.Sprintf("reached time limit %s", stop.maxTime)
+			return
+		case key, ok := <-keys:
+			if !ok {
+				// no more input, keep running without the keys
+				keys = nil
+				continue
+			}
+			if key == 'q' {
+				reason = "stopped from the keyboard"
+				return
+			}
+			t.handleKey(key)
+			t.draw()
+		case <-redraw.C:
+			t.draw()
+		case <-sample.C:
+			t.sample()
+		case entry := <-t.polish.done:
+			t.polishDone(entry, hallOfFame)
+		case next := <-incoming:
+			t.update(next, hallOfFame)
+			if r := stop.reason(sf, t.best, t.generation, t.lastImprovement); r != "" {
+				reason = r
+				return
+			}
+		}
+	}
+}
+
+func (t *tui) update(next *gen.LayoutEntry, hallOfFame *gen.HallOfFame) {
+	t.generation++
+	if next.Worker < len(t.workers) {
+		worker := &t.workers[next.Worker]
+		worker.generation = next.Generation
+		worker.diversity = next.Diversity
+		if next.Score > worker.best {
+			worker.best = next.Score
+		}
+	}
+
+	// layouts from the generations before pinning may not have the pins
+	if !t.pins.Allows(&next.Layout) {
+		return
+	}
+	hallOfFame.Add(next)
+	if t.best == nil || t.best.Score < next.Score {
+		t.best = next
+		t.lastImprovement = t.generation
+		t.polish.start(t.best)
+	}
+}
+
+// Takes the polished layout as the best if it still is, and polishes
+// the best found while polishing
+func (t *tui) polishDone(entry *gen.LayoutEntry, hallOfFame *gen.HallOfFame) {
+	// the pins may have changed while polishing
+	if entry.Score > t.best.Score && t.pins.Allows(&entry.Layout) {
+		t.best = entry
+		hallOfFame.Add(entry)
+	}
+	t.polish.finished(entry, t.best)
+}
+
+func (t *tui) handleKey(key rune) {
+	t.message = ""
+	switch key {
+	case ' ':
+		t.paused = !t.paused
+	case 'h':
+		if t.cursor%10 > 0 {
+			t.cursor--
+		}
+	case 'l':
+		if t.cursor%10 < 9 {
+			t.cursor++
+		}
+	case 'k':
+		if t.cursor >= 10 {
+			t.cursor -= 10
+		}
+	case 'j':
+		if t.cursor < 20 {
+			t.cursor += 10
+		}
+	case 'p':
+		if _, ok := t.pins.Pinned(t.cursor); ok {
+			t.pins.Unpin(t.cursor)
+			t.message = "unpinned"
+			return
+		}
+		if t.best == nil {
+			t.message = "nothing to pin yet"
+			return
+		}
+		// the best has all the other pins, so the character is free
+		t.pins.Pin(t.cursor, t.best.Layout[t.cursor])
+		t.message = fmt.Sprintf("pinned '%c'", t.mapping.ID2Rune[t.best.Layout[t.cursor]])
+	case 's':
+		if t.best == nil {
+			t.message = "nothing to save yet"
+			return
+		}
+		if err := t.save(); err != nil {
+			t.message = err.Error()
+			return
+		}
+		t.message = "saved to " + t.saveFile
+	}
+}
+
+// Appends the best layout to the save file in the format of -hof-export
+func (t *tui) save() error {
+	file, err := os.OpenFile(t.saveFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(file, "%.12f %s\n", t.sf.NormalizeScore(t.best.Score), t.mapping.LayoutString(&t.best.Layout))
+	return file.Close()
+}
+
+// Counts the generations per second and adds the best to the history
+func (t *tui) sample() {
+	now := time.Now()
+	t.rate = float64(t.generation-t.rateGeneration) / now.Sub(t.rateTime).Seconds()
+	t.rateGeneration = t.generation
+	t.rateTime = now
+
+	if t.best == nil {
+		return
+	}
+	t.history = append(t.history, t.sf.NormalizeScore(t.best.Score))
+	if len(t.history) > sparklineWidth {
+		t.history = t.history[len(t.history)-sparklineWidth:]
+	}
+}
+
+func (t *tui) draw() {
+	var b strings.Builder
+	line := func(format string, args ...interface{}) {
+		fmt.Fprintf(&b, format, args...)
+		// clear the rest of the previous content on the line
+		b.WriteString("\x1b[K\n")
+	}
+
+	// draw over the previous screen from the top left corner
+	b.WriteString("\x1b[H")
+
+	state := "running"
+	if t.paused {
+		state = "\x1b[7m PAUSED \x1b[0m"
+	}
+	if t.polish.running {
+		state += "  polishing"
+	}
+	line("kbdgen  %s", state)
+	line("")
+	line("generation %-10d %8.0f gen/s   elapsed %-10s since improvement %d",
+		t.generation, t.rate, time.Since(t.started).Round(time.Second), t.generation-t.lastImprovement)
+
+	if t.best == nil {
+		line("best       -")
+	} else {
+		metrics := fmt.Sprintf("best       %.12f (raw %d)   pinned %d", t.sf.NormalizeScore(t.best.Score), t.best.Score, t.pins.Len())
+		if t.reference != nil {
+			metrics += fmt.Sprintf("   %d keys moved", kbdlayout.MovedKeys(&t.best.Layout, t.reference))
+		}
+		line("%s", metrics)
+	}
+	line("")
+	t.drawLayout(line)
+	line("")
+	line("score %s", sparkline(t.history))
+	line("")
+
+	for i, worker := range t.workers {
+		best := "-"
+		if worker.best > 0 {
+			best = fmt.Sprintf("%.12f", t.sf.NormalizeScore(worker.best))
+		}
+		line("worker %-3d generation %-10d best %s   diversity %.3f", i+1, worker.generation, best, worker.diversity)
+	}
+	line("")
+	line("%s", tuiHelp)
+	line("%s", t.message)
+
+	// clear anything below
+	b.WriteString("\x1b[J")
+	os.Stdout.WriteString(b.String())
+}
+
+// Draws the best layout with the cursor in reverse video and the pinned
+// keys in brackets
+func (t *tui) drawLayout(line func(format string, args ...interface{})) {
+	for row := 0; row < 3; row++ {
+		var keys strings.Builder
+		for col := 0; col < 10; col++ {
+			pos := row*10 + col
+			if col == 5 {
+				keys.WriteString("  ")
+			}
+
+			char := ' '
+			if t.best != nil {
+				char = t.mapping.ID2Rune[t.best.Layout[pos]]
+			}
+			key := fmt.Sprintf(" %c ", char)
+			if _, ok := t.pins.Pinned(pos); ok {
+				key = fmt.Sprintf("[%c]", char)
+			}
+			if pos == t.cursor {
+				key = "\x1b[7m" + key + "\x1b[0m"
+			}
+			keys.WriteString(key)
+		}
+		line("    %s", keys.String())
+	}
+}
+
+// Draws the values as bars scaled from the smallest to the largest
+func sparkline(values []float64) string {
+	if len(values) == 0 {
+		return ""
+	}
+	min, max := values[0], values[0]
+	for _, v := range values {
+		if v < min {
+			min = v
+		}
+		if v > max {
+			max = v
+		}
+	}
+
+	bars := make([]rune, len(values))
+	for i, v := range values {
+		level := 0
+		if max > min {
+			level = int((v - min) / (max - min) * float64(len(sparkBars)-1))
+		}
+		bars[i] = sparkBars[level]
+	}
+	return fmt.Sprintf("%s  %.6f .. %.6f", string(bars), min, max)
+}
+
+// Switches the terminal to read keys without waiting for enter and
+// to an alternate screen. Returns a function to switch back.
+func enterTerminal() func() {
+	sttyState, err := stty("-g")
+	if err != nil {
+		log.Fatalf("the terminal UI needs a terminal: %v", err)
+	}
+	// keep the signals working, so ctrl-c stops as usual
+	if _, err := stty("-icanon", "-echo", "min", "1"); err != nil {
+		log.Fatalf("the terminal UI needs a terminal: %v", err)
+	}
+	// alternate screen, hidden cursor
+	os.Stdout.WriteString("\x1b[?1049h\x1b[?25l\x1b[2J")
+
+	return func() {
+		os.Stdout.WriteString("\x1b[?25h\x1b[?1049l")
+		stty(strings.TrimSpace(sttyState))
+	}
+}
+
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	output, err := cmd.Output()
+	return string(output), err
+}
+
+// Reads the keys from the terminal, mapping arrows to hjkl
+func readKeys() <-chan rune {
+	keys := make(chan rune)
+	go func() {
+		buffer := make([]byte, 16)
+		for {
+			n, err := os.Stdin.Read(buffer)
+			if err != nil {
+				close(keys)
+				return
+			}
+			input := buffer[:n]
+			for len(input) > 0 {
+				if len(input) >= 3 && input[0] == 0x1b && input[1] == '[' {
+					if key, ok := arrowKeys[input[2]]; ok {
+						keys <- key
+					}
+					input = input[3:]
+					continue
+				}
+				keys <- rune(input[0])
+				input = input[1:]
+			}
+		}
+	}()
+	return keys
+}
+
+var arrowKeys = map[byte]rune{'A': 'k', 'B': 'j', 'C': 'l', 'D': 'h'}